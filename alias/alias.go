@@ -0,0 +1,141 @@
+package alias
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ALL_ARGS in an alias is replaced by the args not used by positional parameters (`$1`, `$2`...).
+// Without ALL_ARGS, any unused args are appended to the expanded command-line
+const ALL_ARGS = "$@"
+
+var positionalParam = regexp.MustCompile(`\$(?:(\d+)|\{(\d+)(?::-([^}]*))?\})`)
+
+// Split splits an alias command-line into words, as a shell would (with quotes and backslash escapes)
+func Split(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, quote := false, rune(0)
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == 0 && (r == ' ' || r == '\t' || r == '\n'):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case quote == 0 && (r == '\'' || r == '"'):
+			quote, inWord = r, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case r == '\\' && quote != '\'' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, line)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// Expand returns the command-line words for `template` with its positional parameters
+// (`$1`, `${2}`, `${3:-default}`) and ALL_ARGS replaced from `args`
+func Expand(template string, args []string) ([]string, error) {
+	words, err := Split(template)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[int]bool)
+	var expandErr error
+	hasAllArgs := false
+	expanded := make([]string, 0, len(words)+len(args))
+	for _, word := range words {
+		if word == ALL_ARGS {
+			hasAllArgs = true
+			expanded = append(expanded, ALL_ARGS) // placeholder, replaced below
+			continue
+		}
+		word = positionalParam.ReplaceAllStringFunc(word, func(param string) string {
+			m := positionalParam.FindStringSubmatch(param)
+			numStr, hasDefault := m[1]+m[2], strings.Contains(param, ":-")
+			n, _ := strconv.Atoi(numStr)
+			if n >= 1 && n <= len(args) {
+				used[n] = true
+				return args[n-1]
+			}
+			if hasDefault {
+				return m[3]
+			}
+			if expandErr == nil {
+				expandErr = fmt.Errorf("missing argument $%d for alias %q", n, template)
+			}
+			return ""
+		})
+		expanded = append(expanded, word)
+	}
+	if expandErr != nil {
+		return nil, expandErr
+	}
+
+	var rest []string
+	for i, arg := range args {
+		if !used[i+1] {
+			rest = append(rest, arg)
+		}
+	}
+	if !hasAllArgs {
+		return append(expanded, rest...), nil
+	}
+
+	result := make([]string, 0, len(expanded)+len(rest))
+	for _, word := range expanded {
+		if word == ALL_ARGS {
+			result = append(result, rest...)
+		} else {
+			result = append(result, word)
+		}
+	}
+	return result, nil
+}
+
+// FindCycles returns the (sorted) names of aliases whose expansion would never end,
+// where an alias refers to another alias by its first word
+func FindCycles(aliases map[string]string) []string {
+	next := make(map[string]string)
+	for name, template := range aliases {
+		if words, err := Split(template); err == nil && len(words) > 0 {
+			if _, isAlias := aliases[words[0]]; isAlias {
+				next[name] = words[0]
+			}
+		}
+	}
+
+	var cyclic []string
+	for name := range aliases {
+		seen := map[string]bool{name: true}
+		for cur, ok := next[name]; ok; cur, ok = next[cur] {
+			if seen[cur] {
+				cyclic = append(cyclic, name)
+				break
+			}
+			seen[cur] = true
+		}
+	}
+	sort.Strings(cyclic)
+	return cyclic
+}
@@ -0,0 +1,89 @@
+package alias
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSplit(t *testing.T) {
+	Convey("Given alias command-lines need splitting into words", t, func() {
+
+		Convey("When the line has quotes and escapes", func() {
+			words, err := Split(`ssh sandbox web 1 -- "sudo docker ps" 'a "b"' c\ d`)
+
+			Convey("Then the words should be split as a shell would", func() {
+				So(err, ShouldBeNil)
+				So(words, ShouldResemble, []string{"ssh", "sandbox", "web", "1", "--", "sudo docker ps", `a "b"`, "c d"})
+			})
+		})
+
+		Convey("When a quote is not terminated", func() {
+			_, err := Split(`ssh "sandbox`)
+
+			Convey("Then there should be an error returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "unterminated")
+			})
+		})
+	})
+}
+
+func TestExpand(t *testing.T) {
+	Convey("Given an alias with positional parameters", t, func() {
+		template := "ssh sandbox publishing $1 -p 8080:15900 -- sudo docker ${2:-ps}"
+
+		Convey("When all the args are given", func() {
+			words, err := Expand(template, []string{"2", "logs", "extra"})
+
+			Convey("Then they should be substituted, and unused args appended", func() {
+				So(err, ShouldBeNil)
+				So(words, ShouldResemble, []string{"ssh", "sandbox", "publishing", "2", "-p", "8080:15900", "--", "sudo", "docker", "logs", "extra"})
+			})
+		})
+
+		Convey("When an arg with a default is missing", func() {
+			words, err := Expand(template, []string{"1"})
+
+			Convey("Then the default should be used", func() {
+				So(err, ShouldBeNil)
+				So(words[len(words)-1], ShouldEqual, "ps")
+			})
+		})
+
+		Convey("When a required arg is missing", func() {
+			_, err := Expand(template, nil)
+
+			Convey("Then there should be an error returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "missing argument $1")
+			})
+		})
+
+		Convey("When the alias places the remaining args with $@", func() {
+			words, err := Expand("ssh $1 web 1 -- $@ | tail", []string{"prod", "ls", "-la"})
+
+			Convey("Then the remaining args should be placed there", func() {
+				So(err, ShouldBeNil)
+				So(words, ShouldResemble, []string{"ssh", "prod", "web", "1", "--", "ls", "-la", "|", "tail"})
+			})
+		})
+	})
+}
+
+func TestFindCycles(t *testing.T) {
+	Convey("Given aliases that refer to other aliases", t, func() {
+		aliases := map[string]string{
+			"ok":     "ssh sandbox web 1",
+			"alsoOk": "ok -- date",
+			"a":      "b $1",
+			"b":      "a",
+			"c":      "a",
+			"self":   "self",
+		}
+
+		Convey("Then the aliases which never end should be found", func() {
+			So(FindCycles(aliases), ShouldResemble, []string{"a", "b", "c", "self"})
+		})
+	})
+}
@@ -1,6 +1,8 @@
 package aws
 
 import (
+	"errors"
+
 	"github.com/aws/aws-sdk-go/aws/session"
 )
 
@@ -13,3 +15,22 @@ func getAWSSession(profile string) *session.Session {
 	}
 	return session.Must(session.NewSessionWithOptions(opts))
 }
+
+// CheckProfile ensures the AWS profile loads, has a region and that its credentials (e.g. SSO session) are valid
+func CheckProfile(profile string) error {
+	opts := session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}
+	if profile != "" {
+		opts.Profile = profile
+	}
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return err
+	}
+	if sess.Config.Region == nil || len(*sess.Config.Region) == 0 {
+		return errors.New("MissingRegion: could not find region configuration")
+	}
+	_, err = sess.Config.Credentials.Get()
+	return err
+}
@@ -53,13 +53,9 @@ func getNamedSG(name, environment, profile string, userName *string, ports []int
 		},
 	}
 	if len(environment) > 0 {
-		expectEnvTag := environment
-		if cfg.IsCI(environment) {
-			expectEnvTag = "ci"
-		}
 		filters = append(filters, &ec2.Filter{
 			Name:   aws.String("tag:Environment"),
-			Values: []*string{aws.String(expectEnvTag)},
+			Values: []*string{aws.String(cfg.GetPolicy(environment).AWSEnvironmentTag)},
 		})
 	}
 
@@ -143,12 +139,15 @@ func getELBPublishingSGForEnvironment(environment, profile string, userName *str
 }
 
 func getELBWebSGForEnvironment(environment, profile string, userName *string, extraPorts []int64, cfg *config.Config) (secGroup, error) {
-	sgName := environment + " - web elb"
-	if cfg.IsNisra(environment) {
-		sgName = environment + " - cantabular-ui elb"
-	}
 	return getNamedSG(
-		sgName, environment, profile, userName,
+		environment+" - web elb", environment, profile, userName,
+		append(extraPorts, 80, 443), cfg,
+	)
+}
+
+func getELBCantabularUISGForEnvironment(environment, profile string, userName *string, extraPorts []int64, cfg *config.Config) (secGroup, error) {
+	return getNamedSG(
+		environment+" - cantabular-ui elb", environment, profile, userName,
 		append(extraPorts, 80, 443), cfg,
 	)
 }
@@ -161,6 +160,25 @@ func getConcourseWorkerSG(userName *string, profile string, cfg *config.Config)
 	return getNamedSG("concourse-ci-worker", "", profile, userName, []int64{CONCOURSE_SSH_PORT}, cfg)
 }
 
+// getSGForTarget returns the SG for a policy `security-groups` target
+func getSGForTarget(sgTarget, environment, profile string, userName *string, extraPorts config.ExtraPorts, cfg *config.Config) (secGroup, error) {
+	switch sgTarget {
+	case config.SG_BASTION:
+		return getBastionSGForEnvironment(environment, profile, userName, extraPorts.Bastion, cfg)
+	case config.SG_PUBLISHING_ELB:
+		return getELBPublishingSGForEnvironment(environment, profile, userName, extraPorts.Publishing, cfg)
+	case config.SG_WEB_ELB:
+		return getELBWebSGForEnvironment(environment, profile, userName, extraPorts.Web, cfg)
+	case config.SG_CANTABULAR_UI_ELB:
+		return getELBCantabularUISGForEnvironment(environment, profile, userName, extraPorts.Web, cfg)
+	case config.SG_CONCOURSE_WEB:
+		return getConcourseWebSG(userName, profile, cfg)
+	case config.SG_CONCOURSE_WORKER:
+		return getConcourseWorkerSG(userName, profile, cfg)
+	}
+	return secGroup{}, fmt.Errorf("unknown security group %q in policy for environment %q", sgTarget, environment)
+}
+
 // AllowIPForEnvironment adds your IP to this environment
 func AllowIPForEnvironment(userName *string, environment, profile string, extraPorts config.ExtraPorts, cfg *config.Config) error {
 	return changeIPsForEnvironment(true, userName, environment, profile, extraPorts, cfg)
@@ -189,45 +207,12 @@ func changeIPsForEnvironment(isAllow bool, userName *string, environment, profil
 	// build `secGroups` (wanted changes, per relevant security group) for `environment`
 	var secGroups []secGroup
 	var sg secGroup
-	var ec2Svc *ec2.EC2
-	if cfg.IsCI(environment) {
-		ec2Svc = getEC2Service(profile)
-		if sg, err = getConcourseWebSG(userName, profile, cfg); err != nil {
-			return err
-		}
-		secGroups = append(secGroups, sg)
-
-		if sg, err = getConcourseWorkerSG(userName, profile, cfg); err != nil {
-			return err
-		}
-		secGroups = append(secGroups, sg)
-
-	} else if cfg.IsNisra(environment) {
-		ec2Svc = getEC2Service(profile)
-		if sg, err = getELBWebSGForEnvironment(environment, profile, userName, extraPorts.Web, cfg); err != nil {
-			return err
-		}
-		secGroups = append(secGroups, sg)
-
-	} else {
-		ec2Svc = getEC2Service(profile)
-		if sg, err = getBastionSGForEnvironment(environment, profile, userName, extraPorts.Bastion, cfg); err != nil {
-			return err
-		}
-		secGroups = append(secGroups, sg)
-
-		if !cfg.IsLive(environment) {
-			if sg, err = getELBPublishingSGForEnvironment(environment, profile, userName, extraPorts.Publishing, cfg); err != nil {
-				return err
-			}
-			secGroups = append(secGroups, sg)
-		}
-
-		if sg, err = getELBWebSGForEnvironment(environment, profile, userName, extraPorts.Web, cfg); err != nil {
+	ec2Svc := getEC2Service(profile)
+	for _, sgTarget := range cfg.GetPolicy(environment).SecurityGroups {
+		if sg, err = getSGForTarget(sgTarget, environment, profile, userName, extraPorts, cfg); err != nil {
 			return err
 		}
 		secGroups = append(secGroups, sg)
-
 	}
 
 	// apply `secGroups` changes
@@ -279,6 +264,33 @@ func changeIPsForEnvironment(isAllow bool, userName *string, environment, profil
 	return nil
 }
 
+// GetMissingAccessForEnvironment returns the ports (keyed on SG name) that do not allow `myIP` for userName
+func GetMissingAccessForEnvironment(userName *string, environment, profile string, extraPorts config.ExtraPorts, myIP string, cfg *config.Config) (map[string][]int64, error) {
+	if !strings.Contains(myIP, "/") {
+		myIP += "/32"
+	}
+	missing := make(map[string][]int64)
+	for _, sgTarget := range cfg.GetPolicy(environment).SecurityGroups {
+		sg, err := getSGForTarget(sgTarget, environment, profile, userName, extraPorts, cfg)
+		if err != nil {
+			return nil, err
+		}
+		for _, port := range sg.ports {
+			isAllowed := false
+			for _, cidr := range sg.portToMyIPs[port] {
+				if cidr == myIP {
+					isAllowed = true
+					break
+				}
+			}
+			if !isAllowed {
+				missing[sg.name] = append(missing[sg.name], port)
+			}
+		}
+	}
+	return missing, nil
+}
+
 // ListEC2ByAnsibleGroup returns EC2 instances matching ansibleGroup for this env/profile
 func ListEC2ByAnsibleGroup(environment, profile string, ansibleGroup string, cfg *config.Config) ([]EC2Result, error) {
 	r, err := ListEC2(environment, profile, cfg)
@@ -310,15 +322,12 @@ func ListEC2(environment, profile string, cfg *config.Config) ([]EC2Result, erro
 
 	var result *ec2.DescribeInstancesOutput
 	var err error
-	expectEnvTag := environment
-	if cfg.IsCI(environment) {
-		expectEnvTag = "ci"
-	}
+	policy := cfg.GetPolicy(environment)
 	request := &ec2.DescribeInstancesInput{
 		Filters: []*ec2.Filter{
 			{
 				Name:   aws.String("tag:Environment"),
-				Values: []*string{aws.String(expectEnvTag)},
+				Values: []*string{aws.String(policy.AWSEnvironmentTag)},
 			},
 			{
 				Name:   aws.String("instance-state-name"),
@@ -352,7 +361,7 @@ func ListEC2(environment, profile string, cfg *config.Config) ([]EC2Result, erro
 					}
 				}
 				var ipAddr string
-				if cfg.IsCI(environment) && cfg.IsAWSA(environment) {
+				if policy.IsPublicIP() {
 					if len(i.NetworkInterfaces) > 0 &&
 						i.NetworkInterfaces[0].Association != nil &&
 						len(*i.NetworkInterfaces[0].Association.PublicIp) > 0 &&
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// ExitError is an error with the exit code that dp should exit with (e.g. that of a remote command).
+// Without Err, it is silent: only the exit code is passed on (e.g. from a plugin, which shows its own errors)
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+// IsSilent returns whether `err` is a silent ExitError, so should not be shown
+func IsSilent(err error) bool {
+	var exitErr ExitError
+	return errors.As(err, &exitErr) && exitErr.Err == nil
+}
+
+func (e ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code for `err`: 0 if nil, the code of an ExitError or of an exited command, else 1
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	var cmdErr *exec.ExitError
+	if errors.As(err, &cmdErr) {
+		if code := cmdErr.ExitCode(); code >= 0 {
+			return code
+		}
+		// killed by a signal (exit code -1)
+		if status, ok := cmdErr.Sys().(interface {
+			Signaled() bool
+			Signal() syscall.Signal
+		}); ok && status.Signaled() {
+			return SignalExitCode(status.Signal())
+		}
+	}
+	return 1
+}
+
+// SignalExitCode is the (shell convention) exit code for a process stopped by `sig`, e.g. 130 for SIGINT
+func SignalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+// SignalForwarder catches SIGINT and SIGTERM (so that they do not stop dp) and forwards
+// the first one caught to the process of its Commands
+type SignalForwarder struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	ch     chan os.Signal
+	mu     sync.Mutex
+	sig    os.Signal
+}
+
+// CatchSignals starts catching SIGINT and SIGTERM, until Stop is called
+func CatchSignals() *SignalForwarder {
+	f := &SignalForwarder{ch: make(chan os.Signal, 1)}
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+	signal.Notify(f.ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range f.ch {
+			f.mu.Lock()
+			if f.sig == nil {
+				f.sig = sig
+			}
+			f.mu.Unlock()
+			f.cancel()
+		}
+	}()
+	return f
+}
+
+// Command returns a command (as exec.Command) to which the first caught signal is forwarded.
+// Once a signal has been caught, commands are not started
+func (f *SignalForwarder) Command(name string, arg ...string) *exec.Cmd {
+	c := exec.CommandContext(f.ctx, name, arg...)
+	c.Cancel = func() error {
+		if sig := f.Signal(); sig != nil {
+			return c.Process.Signal(sig)
+		}
+		return c.Process.Kill()
+	}
+	return c
+}
+
+// Signal returns the signal caught, or nil if none
+func (f *SignalForwarder) Signal() os.Signal {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sig
+}
+
+// Stop stops catching signals
+func (f *SignalForwarder) Stop() {
+	signal.Stop(f.ch)
+	close(f.ch)
+	f.cancel()
+}
@@ -0,0 +1,85 @@
+package clipboard
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Clipboard is what `--clipboard` copies to (or from)
+type Clipboard interface {
+	Read() ([]byte, error)
+	Write(b []byte) error
+}
+
+// command is a clipboard used through the OS's copy and paste commands
+type command struct {
+	copyArgs  []string
+	pasteArgs []string
+}
+
+func (c command) Read() ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(c.pasteArgs[0], c.pasteArgs[1:]...)
+	cmd.Stderr = &stderr
+	b, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the clipboard (%s): %w: %s", c.pasteArgs[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return b, nil
+}
+
+func (c command) Write(b []byte) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(c.copyArgs[0], c.copyArgs[1:]...)
+	cmd.Stdin, cmd.Stderr = bytes.NewReader(b), &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cannot write the clipboard (%s): %w: %s", c.copyArgs[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// New returns the OS clipboard
+func New() (Clipboard, error) {
+	return getCommand(runtime.GOOS, exec.LookPath, os.Getenv)
+}
+
+// getCommand returns the clipboard commands for the OS `goos`, using the tools found by `lookPath`
+func getCommand(goos string, lookPath func(string) (string, error), getenv func(string) string) (command, error) {
+	switch goos {
+	case "darwin":
+		return command{[]string{"pbcopy"}, []string{"pbpaste"}}, nil
+	case "windows":
+		return command{[]string{"clip"}, []string{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"}}, nil
+	}
+	isFound := func(tool string) bool {
+		_, err := lookPath(tool)
+		return err == nil
+	}
+	switch {
+	case getenv("WAYLAND_DISPLAY") != "" && isFound("wl-copy"):
+		return command{[]string{"wl-copy"}, []string{"wl-paste", "--no-newline"}}, nil
+	case isFound("xclip"):
+		return command{[]string{"xclip", "-selection", "clipboard", "-in"}, []string{"xclip", "-selection", "clipboard", "-out"}}, nil
+	case isFound("xsel"):
+		return command{[]string{"xsel", "--clipboard", "--input"}, []string{"xsel", "--clipboard", "--output"}}, nil
+	}
+	return command{}, errors.New("no clipboard tool found (install wl-clipboard, xclip or xsel)")
+}
+
+// File is a clipboard kept in a file (e.g. a stand-in for the OS clipboard in tests)
+type File struct {
+	Path string
+}
+
+func (f File) Read() ([]byte, error) {
+	return os.ReadFile(f.Path)
+}
+
+func (f File) Write(b []byte) error {
+	return os.WriteFile(f.Path, b, 0600)
+}
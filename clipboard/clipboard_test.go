@@ -0,0 +1,56 @@
+package clipboard
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetCommand(t *testing.T) {
+	Convey("The clipboard commands should depend on the OS and the tools installed", t, func() {
+		for _, tc := range []struct {
+			goos     string
+			tools    []string
+			wayland  string
+			wantCopy string
+			isErr    bool
+		}{
+			{goos: "darwin", wantCopy: "pbcopy"},
+			{goos: "windows", wantCopy: "clip"},
+			{goos: "linux", tools: []string{"wl-copy", "xclip"}, wayland: "wayland-0", wantCopy: "wl-copy"},
+			{goos: "linux", tools: []string{"wl-copy", "xclip"}, wantCopy: "xclip"},
+			{goos: "linux", tools: []string{"xsel"}, wantCopy: "xsel"},
+			{goos: "linux", isErr: true},
+		} {
+			lookPath := func(tool string) (string, error) {
+				for _, t := range tc.tools {
+					if t == tool {
+						return "/usr/bin/" + tool, nil
+					}
+				}
+				return "", errors.New("not found")
+			}
+			c, err := getCommand(tc.goos, lookPath, func(string) string { return tc.wayland })
+			if tc.isErr {
+				So(err, ShouldNotBeNil)
+				continue
+			}
+			So(err, ShouldBeNil)
+			So(c.copyArgs[0], ShouldEqual, tc.wantCopy)
+		}
+	})
+}
+
+func TestFile(t *testing.T) {
+	Convey("A file clipboard should read what was written", t, func() {
+		var c Clipboard = File{Path: filepath.Join(t.TempDir(), "clipboard")}
+		_, err := c.Read()
+		So(err, ShouldNotBeNil)
+		So(c.Write([]byte(`{"a":1}`)), ShouldBeNil)
+		b, err := c.Read()
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"a":1}`)
+	})
+}
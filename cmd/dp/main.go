@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 
+	"github.com/ONSdigital/dp-cli/cli"
 	"github.com/ONSdigital/dp-cli/command"
 	"github.com/ONSdigital/dp-cli/config"
 	"github.com/ONSdigital/dp-cli/out"
@@ -10,8 +11,10 @@ import (
 
 func main() {
 	if err := run(os.Args); err != nil {
-		out.Error(err)
-		os.Exit(1)
+		if !cli.IsSilent(err) {
+			out.Error(err)
+		}
+		os.Exit(cli.ExitCode(err))
 	}
 }
 
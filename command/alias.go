@@ -0,0 +1,77 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ONSdigital/dp-cli/alias"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/out"
+
+	"github.com/spf13/cobra"
+)
+
+const aliasGroupID = "aliases"
+
+// aliasCommands builds a cobra.Command for each alias in the config, skipping any that
+// clash with the existing sub-commands or never end (e.g. `a: b` and `b: a`)
+func aliasCommands(cfg *config.Config, existing []*cobra.Command) []*cobra.Command {
+	reserved := map[string]bool{"help": true, "completion": true}
+	for _, c := range existing {
+		reserved[c.Name()] = true
+	}
+
+	cyclic := make(map[string]bool)
+	for _, name := range alias.FindCycles(cfg.Aliases) {
+		out.WarnFHighlight("warning: alias %s is cyclic - skipping", name)
+		cyclic[name] = true
+	}
+
+	names := make([]string, 0, len(cfg.Aliases))
+	for name := range cfg.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	commands := make([]*cobra.Command, 0)
+	for _, name := range names {
+		template := cfg.Aliases[name]
+		if cyclic[name] {
+			continue
+		}
+		if reserved[name] || strings.ContainsAny(name, " \t") {
+			out.WarnFHighlight("warning: alias %s clashes with a dp command (or has spaces) - skipping", name)
+			continue
+		}
+		if words, err := alias.Split(template); err != nil || len(words) == 0 {
+			out.WarnFHighlight("warning: alias %s has an invalid command-line %q - skipping", name, template)
+			continue
+		}
+
+		commands = append(commands, &cobra.Command{
+			Use:                name,
+			Short:              fmt.Sprintf("alias for: dp %s", template),
+			GroupID:            aliasGroupID,
+			DisableFlagParsing: true,
+			// the error is shown by the command which the alias runs
+			SilenceErrors: true,
+			SilenceUsage:  true,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				words, err := alias.Expand(template, args)
+				if err != nil {
+					return err
+				}
+				return runCommandLine(words)
+			},
+		})
+	}
+	return commands
+}
+
+// runCommandLine runs the dp sub-command for the command-line `words` (the args after `dp`), as dp would
+// (parsing its flags, running any persistent pre-runs and validating its args)
+func runCommandLine(words []string) error {
+	root.SetArgs(words)
+	return root.Execute()
+}
@@ -2,18 +2,22 @@ package command
 
 import (
 	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/confirm"
 	"github.com/ONSdigital/dp-cli/customisemydata"
 	"github.com/ONSdigital/dp-cli/zebedee"
 
 	"github.com/spf13/cobra"
 )
 
+// localEnvironment names your local environment in confirmations, as clean does not use a config environment
+const localEnvironment = "your local environment"
+
 func cleanSubCommand(cfg *config.Config) *cobra.Command {
 	command := &cobra.Command{
 		Use:   "clean",
 		Short: "Delete data from your local environment",
 	}
-	command.AddCommand(tearDownCustomiseMyData(cfg), clearCollections())
+	command.AddCommand(tearDownCustomiseMyData(cfg), clearCollections(cfg))
 	return command
 }
 
@@ -23,7 +27,10 @@ func tearDownCustomiseMyData(cfg *config.Config) *cobra.Command {
 		Use:   "cmd",
 		Short: "Drop all CMD data from your local environment",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			var err error
+			err := confirm.Ask(cfg.GetCleanConfirm(), localEnvironment, "drop all CMD data", *assumeYes)
+			if err != nil {
+				return err
+			}
 
 			err = zebedee.DeleteCollections()
 			if err != nil {
@@ -46,11 +53,14 @@ func tearDownCustomiseMyData(cfg *config.Config) *cobra.Command {
 }
 
 // clearCollections delete all collections from your local publishing stack
-func clearCollections() *cobra.Command {
+func clearCollections(cfg *config.Config) *cobra.Command {
 	return &cobra.Command{
 		Use:   "collections",
 		Short: "Delete all Zebedee collections in your local environment",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := confirm.Ask(cfg.GetCleanConfirm(), localEnvironment, "delete all Zebedee collections", *assumeYes); err != nil {
+				return err
+			}
 			return zebedee.DeleteCollections()
 		},
 	}
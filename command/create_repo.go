@@ -1,30 +1,39 @@
 package command
 
 import (
+	"github.com/ONSdigital/dp-cli/config"
 	"github.com/ONSdigital/dp-cli/repository_creation"
 
 	"github.com/spf13/cobra"
 )
 
-func createRepoSubCommand() *cobra.Command {
+func createRepoSubCommand(cfg *config.Config) *cobra.Command {
 	command := &cobra.Command{
 		Use:   "create-repo",
 		Short: "Creates a new repository with the typical Dissemination Platform configurations ",
 	}
 
-	command.AddCommand(createGithubRepo())
+	command.AddCommand(createGithubRepo(cfg))
 	return command
 }
 
-func createGithubRepo() *cobra.Command {
+func createGithubRepo(cfg *config.Config) *cobra.Command {
 	command := &cobra.Command{
 		Use:   "github",
 		Short: "Creates a github hosted repository",
-		RunE:  repository_creation.RunGenerateRepo,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// not a flag default, as that would show the token in `--help`
+			if token, _ := cmd.Flags().GetString("token"); token == "" && cfg.GitHubToken != "" {
+				if err := cmd.Flags().Set("token", cfg.GitHubToken); err != nil {
+					return err
+				}
+			}
+			return repository_creation.RunGenerateRepo(cmd, args)
+		},
 	}
 
 	command.Flags().String("name", "", "The name of the application, if Digital specific application it should be prepended with 'dp-'")
-	command.Flags().String("token", "", "The users personal access token")
+	command.Flags().String("token", "", "The users personal access token (default: github-token in config, else $GITHUB_PERSONAL_ACCESS_TOKEN)")
 	command.Flags().String("strategy", "git", "which branching-strategy this is depended on; will configure branches. Currently supported 'git' and 'github'")
 	command.Flags().String("team-slugs", "", "Comma separated list of team slugs for setting permissions.")
 	return command
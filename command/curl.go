@@ -0,0 +1,62 @@
+package command
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/curl"
+	"github.com/ONSdigital/dp-cli/out"
+	"github.com/spf13/cobra"
+)
+
+// curlCommand builds a cobra.Command to make an HTTP request to a service on an environment.
+// The command has the following structure:
+//
+//	curl			# [-X POST] [-d '{...}'] [-H 'Name: value'] [--group publishing] [--instance 1]
+//	    environment	# sandbox <service> <path>
+func curlCommand(cfg *config.Config) *cobra.Command {
+	curlC := &cobra.Command{
+		Use:   "curl",
+		Short: "Make an HTTP request to a service on an environment (via a temporary port-forward)",
+	}
+	opts := curl.Options{
+		Method:             curlC.PersistentFlags().StringP("request", "X", "", "HTTP `method` (default: GET, or POST with --data)"),
+		Data:               curlC.PersistentFlags().StringP("data", "d", "", "request body, or @file (@- for stdin)"),
+		Headers:            curlC.PersistentFlags().StringArrayP("header", "H", nil, "extra request header[s] e.g. 'Accept: text/csv'"),
+		IsIncludingHeaders: curlC.PersistentFlags().BoolP("include", "i", false, "include the response status and headers"),
+		IsRaw:              curlC.PersistentFlags().Bool("raw", false, "do not pretty-print JSON responses"),
+		IsNoAuth:           curlC.PersistentFlags().Bool("no-auth", false, "do not add auth headers from $SERVICE_AUTH_TOKEN and $FLORENCE_TOKEN"),
+		Group:              curlC.PersistentFlags().StringP("group", "g", "", "ansible `group` to forward via (default: the service's group in config)"),
+		InstanceNum:        curlC.PersistentFlags().IntP("instance", "n", 1, "instance number (in the group) to forward via"),
+		Timeout:            curlC.PersistentFlags().Duration("timeout", time.Minute, "timeout for the request"),
+		AssumeYes:          assumeYes,
+	}
+
+	for _, env := range cfg.Environments {
+		curlC.AddCommand(&cobra.Command{
+			Use:   env.Name + " <service> <path>",
+			Short: "HTTP request to a service on " + env.Name,
+			Args:  cobra.ExactArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return curl.Run(cfg, env, args[0], args[1], opts)
+			},
+			ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+				if len(args) > 0 {
+					return nil, cobra.ShellCompDirectiveNoFileComp
+				}
+				services, _ := cfg.GetServices(env)
+				names := make([]string, 0, len(services))
+				for name := range services {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				return names, cobra.ShellCompDirectiveNoFileComp
+			},
+		})
+	}
+	if len(cfg.Environments) == 0 {
+		out.Warn("Warning: No subcommands found for envs - missing envs in config?")
+	}
+	return curlC
+}
@@ -0,0 +1,27 @@
+package command
+
+import (
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/doctor"
+
+	"github.com/spf13/cobra"
+)
+
+// doctorCommand checks your tools, repos and AWS set-up, suggesting remedies for the common issues
+func doctorCommand(cfg *config.Config) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check your environment (tools, repos, AWS profiles, remote access) for common issues",
+	}
+	opts := doctor.Options{
+		IsFetching: command.Flags().Bool("fetch", false, "git fetch the repos before checking they are up to date"),
+		IsOffline:  command.Flags().Bool("offline", false, "skip the AWS profile and remote access checks"),
+		IsJSON:     command.Flags().Bool("json", false, "output the results as JSON"),
+	}
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return doctor.Run(cfg, opts)
+	}
+	return command
+}
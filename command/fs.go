@@ -0,0 +1,155 @@
+package command
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/out"
+	"github.com/ONSdigital/dp-cli/remotefs"
+	"github.com/ONSdigital/dp-cli/scp"
+	"github.com/spf13/cobra"
+)
+
+// fsCommand builds a cobra.Command to browse the files on an instance.
+// The command has the following structure:
+//
+//	fs
+//	    ls		# [-l] [--json] [-a]
+//	    cat		# [--confirm-non-sensitive]
+//	    stat	# [--json]
+//	    find	# [--name glob] [--type file|dir|symlink] [--max-depth N] [-l] [--json]
+//	        environment	# sandbox
+//	            group		# publishing
+//	                instance	# 1 <path>
+func fsCommand(cfg *config.Config) *cobra.Command {
+	fsC := &cobra.Command{
+		Use:   "fs",
+		Short: "Browse the files on an instance (e.g. to find a file to `scp --pull`)",
+	}
+	fsC.AddCommand(fsListCommand(cfg), fsCatCommand(cfg), fsStatCommand(cfg), fsFindCommand(cfg))
+	return fsC
+}
+
+func fsListCommand(cfg *config.Config) *cobra.Command {
+	lsC := &cobra.Command{
+		Use:   "ls",
+		Short: "List a remote dir (default: your remote home dir)",
+	}
+	isLong := lsC.PersistentFlags().BoolP("long", "l", false, "long listing (mode, owner, group, size, modification time)")
+	isJSON := lsC.PersistentFlags().Bool("json", false, "output JSON")
+	isAll := lsC.PersistentFlags().BoolP("all", "a", false, "include hidden entries (names starting with .)")
+
+	lsC.AddCommand(createInstanceTreeSubCommands(cfg, "ls on", "[path]", cobra.MaximumNArgs(1),
+		func(cmd *cobra.Command, env config.Environment, grp string, instances []aws.EC2Result, instanceNum int, args []string) error {
+			p := "."
+			if len(args) > 0 {
+				p = args[0]
+			}
+			entries, err := remotefs.List(cfg, env, instances[instanceNum], p, *isAll)
+			if err != nil {
+				return err
+			}
+			return writeEntries(entries, *isLong, *isJSON, false)
+		})...)
+	return lsC
+}
+
+func fsCatCommand(cfg *config.Config) *cobra.Command {
+	catC := &cobra.Command{
+		Use:   "cat",
+		Short: "Write a remote file to stdout (subject to the environment's pull policy)",
+	}
+	isConfirmed := catC.PersistentFlags().Bool("confirm-non-sensitive", false, "declare: no sensitive files being copied")
+
+	catC.AddCommand(createInstanceTreeSubCommands(cfg, "cat on", "<path>", cobra.ExactArgs(1),
+		func(cmd *cobra.Command, env config.Environment, grp string, instances []aws.EC2Result, instanceNum int, args []string) error {
+			instance := instances[instanceNum]
+			// stdout is the file, so messages (and any declaration) go to stderr
+			defer out.UseStderr()()
+			if err := scp.ApprovePull(cfg, env, []aws.EC2Result{instance}, []string{scp.EscapeGlob(args[0])}, "stdout", *isConfirmed); err != nil {
+				return err
+			}
+			return remotefs.Cat(cfg, env, instance, args[0], os.Stdout)
+		})...)
+	return catC
+}
+
+func fsStatCommand(cfg *config.Config) *cobra.Command {
+	statC := &cobra.Command{
+		Use:   "stat",
+		Short: "Show the details of remote files",
+	}
+	isJSON := statC.PersistentFlags().Bool("json", false, "output JSON")
+
+	statC.AddCommand(createInstanceTreeSubCommands(cfg, "stat on", "<path>...", cobra.MinimumNArgs(1),
+		func(cmd *cobra.Command, env config.Environment, grp string, instances []aws.EC2Result, instanceNum int, args []string) error {
+			var entries []remotefs.Entry
+			for _, p := range args {
+				e, err := remotefs.Stat(cfg, env, instances[instanceNum], p)
+				if err != nil {
+					return err
+				}
+				entries = append(entries, e)
+			}
+			if *isJSON {
+				return remotefs.WriteJSON(os.Stdout, entries)
+			}
+			for _, e := range entries {
+				fmt.Printf("  Path: %s\n", e.Path)
+				if e.LinkTarget != "" {
+					fmt.Printf("  Link: %s\n", e.LinkTarget)
+				}
+				fmt.Printf("  Type: %s\n  Size: %d\n  Mode: %s (%s)\n Owner: %s\n Group: %s\n  Time: %s\n",
+					e.Type, e.Size, e.Mode, e.Perm, e.Owner, e.Group, e.ModTime.Local().Format("2006-01-02 15:04:05 MST"))
+			}
+			return nil
+		})...)
+	return statC
+}
+
+func fsFindCommand(cfg *config.Config) *cobra.Command {
+	findC := &cobra.Command{
+		Use:   "find",
+		Short: "Find files below a remote dir",
+	}
+	opts := remotefs.FindOptions{}
+	findC.PersistentFlags().StringVar(&opts.Name, "name", "", "only names matching the `glob` e.g. '*.log'")
+	findC.PersistentFlags().StringVar(&opts.Type, "type", "", "only entries of the `type` (file, dir or symlink)")
+	findC.PersistentFlags().IntVar(&opts.MaxDepth, "max-depth", 0, "descend at most `N` dirs (0 for no limit)")
+	isLong := findC.PersistentFlags().BoolP("long", "l", false, "long listing (mode, owner, group, size, modification time)")
+	isJSON := findC.PersistentFlags().Bool("json", false, "output JSON")
+
+	findC.AddCommand(createInstanceTreeSubCommands(cfg, "find on", "<path>", cobra.ExactArgs(1),
+		func(cmd *cobra.Command, env config.Environment, grp string, instances []aws.EC2Result, instanceNum int, args []string) error {
+			entries, err := remotefs.Find(cfg, env, instances[instanceNum], args[0], opts)
+			if err != nil {
+				return err
+			}
+			return writeEntries(entries, *isLong, *isJSON, true)
+		})...)
+	return findC
+}
+
+// writeEntries writes the entries to stdout (by path when `isPath`, else by name)
+func writeEntries(entries []remotefs.Entry, isLong, isJSON, isPath bool) error {
+	if isJSON {
+		if entries == nil {
+			entries = []remotefs.Entry{}
+		}
+		return remotefs.WriteJSON(os.Stdout, entries)
+	}
+	for _, e := range entries {
+		name := e.Name
+		if isPath {
+			name = e.Path
+		}
+		if isLong {
+			fmt.Println(remotefs.FormatLong(e, name))
+		} else {
+			fmt.Println(remotefs.FormatShort(e, name))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ONSdigital/dp-cli/ansible"
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/out"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// instanceRunner runs a command for instance `instanceNum` (zero-based) of the group's `instances`
+type instanceRunner func(cmd *cobra.Command, env config.Environment, grp string, instances []aws.EC2Result, instanceNum int, args []string) error
+
+// groupRunner runs a command for all the `instances` of the group
+type groupRunner func(cmd *cobra.Command, env config.Environment, grp string, instances []aws.EC2Result, args []string) error
+
+// createInstanceTreeSubCommands builds the environment sub-commands (as for `ssh`) for a command
+// which runs against an instance. The commands have the following structure:
+//
+//	environment	# sandbox
+//	    group		# publishing
+//	        instance	# 1 [argsUse...]
+func createInstanceTreeSubCommands(cfg *config.Config, verb, argsUse string, args cobra.PositionalArgs, run instanceRunner) []*cobra.Command {
+	return createTreeSubCommands(cfg, verb, func(grpC *cobra.Command, env config.Environment, grp string, instances []aws.EC2Result) {
+		for i, inst := range instances {
+			instX := i
+			use := strconv.Itoa(i + 1)
+			if argsUse != "" {
+				use += " " + argsUse
+			}
+			grpC.AddCommand(&cobra.Command{
+				Use:   use,
+				Short: fmt.Sprintf("%s %s %q (%s) %s", verb, grp, inst.Name, inst.IPAddress, inst.InstanceId),
+				Args:  args,
+				RunE: func(cmd *cobra.Command, args []string) error {
+					return run(cmd, env, grp, instances, instX, args)
+				},
+			})
+		}
+	})
+}
+
+// createGroupTreeSubCommands builds the environment sub-commands for a command which runs against
+// all the instances of a group. The commands have the following structure:
+//
+//	environment	# sandbox
+//	    group		# publishing [argsUse...]
+func createGroupTreeSubCommands(cfg *config.Config, verb, argsUse string, args cobra.PositionalArgs, run groupRunner) []*cobra.Command {
+	return createTreeSubCommands(cfg, verb, func(grpC *cobra.Command, env config.Environment, grp string, instances []aws.EC2Result) {
+		grpC.Use = strings.TrimSpace(grp + " " + argsUse)
+		grpC.Short = fmt.Sprintf("%s %s %s (%d instances)", verb, env.Name, grp, len(instances))
+		grpC.Args = args
+		grpC.RunE = func(cmd *cobra.Command, args []string) error {
+			return run(cmd, env, grp, instances, args)
+		}
+	})
+}
+
+// groupBuilder completes the command for a group of `instances`
+type groupBuilder func(grpC *cobra.Command, env config.Environment, grp string, instances []aws.EC2Result)
+
+// createTreeSubCommands builds the environment sub-commands, each with a group sub-command (built by `build`)
+func createTreeSubCommands(cfg *config.Config, verb string, build groupBuilder) []*cobra.Command {
+	commands := make([]*cobra.Command, 0)
+
+	for _, envTree := range getInstanceTree(cfg) {
+		envC := &cobra.Command{
+			Use:   envTree.env.Name,
+			Short: verb + " " + envTree.env.Name,
+		}
+		for _, grp := range envTree.groups {
+			grpC := &cobra.Command{
+				Use:   grp,
+				Short: fmt.Sprintf("%s %s %s", verb, envTree.env.Name, grp),
+			}
+			build(grpC, envTree.env, grp, envTree.instances[grp])
+			envC.AddCommand(grpC)
+		}
+		commands = append(commands, envC)
+	}
+	return commands
+}
+
+// envInstances is the groups (those with instances, in inventory order) of an environment, and their instances
+type envInstances struct {
+	env       config.Environment
+	groups    []string
+	instances map[string][]aws.EC2Result
+}
+
+var (
+	instanceTreeCfg *config.Config
+	instanceTree    []envInstances
+)
+
+// getInstanceTree returns the groups and instances of the environments whose inventories load. They are loaded
+// once for all the commands built from them, and any which cannot be loaded are warned of once, on stderr
+// (so that the output of commands, e.g. `dp doctor --json`, is not spoilt)
+func getInstanceTree(cfg *config.Config) []envInstances {
+	if instanceTreeCfg == cfg {
+		return instanceTree
+	}
+	defer out.UseStderr()()
+
+	instanceTreeCfg, instanceTree = cfg, make([]envInstances, 0, len(cfg.Environments))
+	for _, env := range cfg.Environments {
+		envTree, err := loadEnvInstances(cfg, env)
+		if err != nil {
+			out.WarnFHighlight("warning: unable to create group commands for env: %s", err)
+			continue
+		}
+		instanceTree = append(instanceTree, envTree)
+	}
+	if len(instanceTree) == 0 {
+		out.Warn("Warning: No subcommands found for envs - missing envs in config?")
+	}
+	return instanceTree
+}
+
+// loadEnvInstances loads the groups of `env` from its inventory, and their instances
+func loadEnvInstances(cfg *config.Config, env config.Environment) (envInstances, error) {
+	envTree := envInstances{env: env, instances: make(map[string][]aws.EC2Result)}
+	groups, err := ansible.GetGroupsForEnvironment(cfg.GetPath(env), env.Name)
+	if err != nil {
+		return envTree, errors.WithMessagef(err, "error loading ansible hosts for %s", env.Name)
+	}
+
+	for _, grp := range groups {
+		instances, err := aws.ListEC2ByAnsibleGroup(env.Name, cfg.GetProfile(env.Name), grp, cfg)
+		if err != nil {
+			return envTree, errors.WithMessagef(err, "error fetching ec2: %+v", env)
+		}
+		if len(instances) == 0 {
+			// no instances available so skip creating a command
+			continue
+		}
+		envTree.groups = append(envTree.groups, grp)
+		envTree.instances[grp] = instances
+	}
+	return envTree, nil
+}
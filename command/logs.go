@@ -0,0 +1,61 @@
+package command
+
+import (
+	"os"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/logs"
+	"github.com/spf13/cobra"
+)
+
+// logsCommand builds a cobra.Command to show the container logs across a group of instances.
+// The command has the following structure:
+//
+//	logs			# [--service dp-dataset-api] [--follow] [--since 10m] [--grep pattern]
+//	    environment	# sandbox
+//	        group		# publishing
+//	    fmt			# [--severity warn] [--namespace dp-*-api] [--fields id,count] < logs.json
+func logsCommand(cfg *config.Config) *cobra.Command {
+	logsC := &cobra.Command{
+		Use:   "logs",
+		Short: "Show (or follow) the container logs of all the instances in a group, merged in time order",
+	}
+	opts := logs.Options{
+		Service: logsC.PersistentFlags().StringP("service", "s", "", "only the containers whose name contains `name` e.g. 'dp-dataset-api'"),
+		Follow:  logsC.PersistentFlags().BoolP("follow", "f", false, "follow the logs"),
+		Since:   logsC.PersistentFlags().String("since", "", "only logs since a `time` (e.g. '2024-01-02T13:00:00') or duration (e.g. '10m')"),
+		Grep:    logsC.PersistentFlags().StringP("grep", "g", "", "only lines matching the (regular expression) `pattern`"),
+	}
+
+	logsC.AddCommand(logsFmtCommand())
+	logsC.AddCommand(createGroupTreeSubCommands(cfg, "logs for", "", cobra.NoArgs,
+		func(cmd *cobra.Command, env config.Environment, grp string, instances []aws.EC2Result, args []string) error {
+			return logs.Run(cfg, env, grp, instances, opts)
+		})...)
+	return logsC
+}
+
+func logsFmtCommand() *cobra.Command {
+	fmtC := &cobra.Command{
+		Use:   "fmt",
+		Short: "Format structured (log.go) JSON log lines on stdin to be readable, e.g. `docker logs x | dp logs fmt`",
+		Args:  cobra.NoArgs,
+	}
+	severity := fmtC.Flags().String("severity", "info", "only events at least as severe as `level` (fatal, error, warn or info)")
+	namespaces := fmtC.Flags().StringSliceP("namespace", "n", nil, "only events from the `namespace[s]` (globs allowed, e.g. 'dp-*-api')")
+	fields := fmtC.Flags().StringSlice("fields", nil, "only show these data `field[s]` of each event (default: all)")
+
+	fmtC.RunE = func(cmd *cobra.Command, args []string) error {
+		maxSeverity, err := logs.ParseSeverity(*severity)
+		if err != nil {
+			return err
+		}
+		f := logs.NewFormatter()
+		f.MaxSeverity = maxSeverity
+		f.Namespaces = *namespaces
+		f.Fields = *fields
+		return logs.Fmt(os.Stdin, os.Stdout, f)
+	}
+	return fmtC
+}
@@ -0,0 +1,61 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/ONSdigital/dp-cli/cli"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/plugin"
+
+	"github.com/spf13/cobra"
+)
+
+const pluginGroupID = "plugins"
+
+// pluginCommands builds a cobra.Command for each `dp-<name>` plugin not clashing with the existing sub-commands
+func pluginCommands(cfg *config.Config, existing []*cobra.Command) []*cobra.Command {
+	reserved := map[string]bool{"help": true, "completion": true}
+	for _, c := range existing {
+		reserved[c.Name()] = true
+		for _, alias := range c.Aliases {
+			reserved[alias] = true
+		}
+	}
+
+	var envNames []string
+	for _, env := range cfg.Environments {
+		envNames = append(envNames, env.Name)
+	}
+
+	commands := make([]*cobra.Command, 0)
+	for _, p := range plugin.Discover(cfg, reserved) {
+		plug := p
+		commands = append(commands, &cobra.Command{
+			Use:                plug.Name,
+			Short:              fmt.Sprintf("plugin %s", plug.Path),
+			GroupID:            pluginGroupID,
+			DisableFlagParsing: true,
+			ValidArgs:          envNames,
+			// the plugin shows its own errors, and dp exits with its exit code
+			SilenceErrors: true,
+			SilenceUsage:  true,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				c, err := plug.Command(cfg, args)
+				if err != nil {
+					return err
+				}
+				if err = c.Run(); err != nil {
+					var exitErr *exec.ExitError
+					if errors.As(err, &exitErr) {
+						return cli.ExitError{Code: cli.ExitCode(err)}
+					}
+					return err
+				}
+				return nil
+			},
+		})
+	}
+	return commands
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/ONSdigital/dp-cli/aws"
 	"github.com/ONSdigital/dp-cli/cli"
 	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/confirm"
 	"github.com/ONSdigital/dp-cli/out"
 	"github.com/spf13/cobra"
 )
@@ -60,6 +61,9 @@ func allowCommand(userName *string, envs []config.Environment, cfg *config.Confi
 			Use:   e.Name,
 			Short: "allow access to " + env.Name,
 			RunE: func(cmd *cobra.Command, args []string) error {
+				if err := confirm.Environment(env, "allow access for "+*userName, *assumeYes); err != nil {
+					return err
+				}
 				lvl := out.GetLevel(env)
 				if !*skipDeny {
 					out.Highlight(lvl, "removing existing access to %s", env.Name)
@@ -94,6 +98,9 @@ func denyCommand(userName *string, envs []config.Environment, cfg *config.Config
 			Use:   e.Name,
 			Short: "deny access to " + env.Name,
 			RunE: func(cmd *cobra.Command, args []string) error {
+				if err := confirm.Environment(env, "deny access for "+*userName, *assumeYes); err != nil {
+					return err
+				}
 				lvl := out.GetLevel(env)
 				out.Highlight(lvl, "denying access to %s", env.Name)
 				return aws.DenyIPForEnvironment(userName, env.Name, cfg.GetProfile(env.Name), env.ExtraPorts, cfg)
@@ -9,6 +9,7 @@ import (
 var (
 	root       *cobra.Command
 	appVersion = "development"
+	assumeYes  *bool // `--yes` given, to skip confirmations
 )
 
 // Load will load the sub-commands
@@ -19,6 +20,8 @@ func Load(cfg *config.Config) (*cobra.Command, error) {
 		Short: "dp is a command-line client providing handy helper tools for ONS Dissemination Platform software engineers",
 	}
 
+	assumeYes = root.PersistentFlags().BoolP("yes", "y", false, "skip confirmation of changes to environments (for automation)")
+
 	// register the root sub-commands.
 	subCommands, err := getSubCommands(cfg)
 	if err != nil {
@@ -26,6 +29,17 @@ func Load(cfg *config.Config) (*cobra.Command, error) {
 	}
 
 	root.AddCommand(subCommands...)
+
+	aliases := aliasCommands(cfg, subCommands)
+	if len(aliases) > 0 {
+		root.AddGroup(&cobra.Group{ID: aliasGroupID, Title: "Alias Commands (aliases in config):"})
+		root.AddCommand(aliases...)
+	}
+
+	if plugins := pluginCommands(cfg, append(subCommands, aliases...)); len(plugins) > 0 {
+		root.AddGroup(&cobra.Group{ID: pluginGroupID, Title: "Plugin Commands (dp-<name> on PATH or in plugins-dir):"})
+		root.AddCommand(plugins...)
+	}
 	return root, nil
 }
 
@@ -34,11 +48,18 @@ func getSubCommands(cfg *config.Config) ([]*cobra.Command, error) {
 		versionSubCommand(),
 		cleanSubCommand(cfg),
 		importDataSubCommand(cfg),
-		createRepoSubCommand(),
+		createRepoSubCommand(cfg),
 		generateProjectSubCommand(),
-		spew(),
+		spew(cfg),
 		remoteAccess(cfg),
 		overrideKey(),
+		doctorCommand(cfg),
+		tunnelCommand(cfg),
+		sessionsCommand(cfg),
+		logsCommand(cfg),
+		curlCommand(cfg),
+		syncCommand(cfg),
+		fsCommand(cfg),
 	}
 
 	ssh, err := sshCommand(cfg)
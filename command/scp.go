@@ -3,13 +3,12 @@ package command
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
-	"github.com/ONSdigital/dp-cli/ansible"
 	"github.com/ONSdigital/dp-cli/aws"
 	"github.com/ONSdigital/dp-cli/config"
-	"github.com/ONSdigital/dp-cli/out"
+	"github.com/ONSdigital/dp-cli/remotefs"
 	"github.com/ONSdigital/dp-cli/scp"
-	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -21,9 +20,11 @@ import (
 //	 environment 	# develop
 //	  group		# publishing_mount
 //	   instance	# 1
-//	    [--pull]
-//	     <fromFile>
-//	      <toFile>
+//	    [--pull [--compress[=zstd]]] [--to N | --all] [--chunked | --resume] [--backend scp|sftp]
+//	     <fromFile>	# or - (stdin)
+//	      <toFile>	# or - (stdout)
+//	    --clipboard [--pull] <remoteFile>
+//	   <n>:<fromFile> <group> <m>:<toFile>	# copy between instances [--direct]
 func scpCommand(cfg *config.Config) (*cobra.Command, error) {
 	scpC := &cobra.Command{
 		Use:   "scp",
@@ -34,14 +35,23 @@ func scpCommand(cfg *config.Config) (*cobra.Command, error) {
 		IsPull:      scpC.PersistentFlags().Bool("pull", false, "pull file - first arg is remote-file [default: push (1st arg local)]"),
 		IsRecursing: scpC.PersistentFlags().BoolP("recurse", "r", false, "recurse - copy recursively"),
 		Verbosity:   scpC.PersistentFlags().CountP("verbose", "v", "verbose - increase scp verbosity"),
+		AssumeYes:   assumeYes,
+
+		InstanceNumMax: scpC.PersistentFlags().IntP("to", "t", -1, "max instance number to copy to/from (0 for highest)"),
+		IsAll:          scpC.PersistentFlags().BoolP("all", "a", false, "copy to/from all instances in the group"),
+		Compress:       scpC.PersistentFlags().String("compress", "", "pull as a tar compressed with gzip (the default) or zstd, verifying checksums"),
+		IsChunked:      scpC.PersistentFlags().Bool("chunked", false, "copy a (large) file in chunks, so an interrupted copy can be resumed with --resume"),
+		ChunkSize:      scpC.PersistentFlags().String("chunk-size", scp.DEFAULT_CHUNK_SIZE, "size of the chunks for --chunked"),
+		IsResume:       scpC.PersistentFlags().Bool("resume", false, "resume an interrupted --chunked copy, only copying chunks not yet copied"),
+		IsDirect:       scpC.PersistentFlags().Bool("direct", false, "copy between instances directly (using your forwarded ssh agent), not via this machine"),
+		IsClipboard:    scpC.PersistentFlags().Bool("clipboard", false, "pull a file to the clipboard (or push the clipboard to a file) - give only the remote file"),
+		Backend:        scpC.PersistentFlags().String("backend", "", "copy with scp or sftp (default: scp-backend in config, else scp)"),
 	}
+	scpC.PersistentFlags().Lookup("compress").NoOptDefVal = scp.COMPRESS_GZIP
 	environmentCommands, err := createEnvironmentSCPSubCommands(cfg, scpOpts)
 	if err != nil {
 		return nil, err
 	}
-	if len(environmentCommands) == 0 {
-		out.Warn("Warning: No subcommands found for envs - missing envs in config?")
-	}
 
 	scpC.AddCommand(environmentCommands...)
 	return scpC, nil
@@ -51,16 +61,15 @@ func scpCommand(cfg *config.Config) (*cobra.Command, error) {
 func createEnvironmentSCPSubCommands(cfg *config.Config, scpOpts scp.Options) ([]*cobra.Command, error) {
 	commands := make([]*cobra.Command, 0)
 
-	for _, env := range cfg.Environments {
+	for _, envTree := range getInstanceTree(cfg) {
 		envC := &cobra.Command{
-			Use:   env.Name,
-			Short: "scp on " + env.Name,
+			Use:   envTree.env.Name,
+			Short: "scp on " + envTree.env.Name,
 		}
 
-		groupCommands, err := createEnvironmentGroupSCPSubCommands(env, cfg, scpOpts)
+		groupCommands, err := createEnvironmentGroupSCPSubCommands(envTree, cfg, scpOpts)
 		if err != nil {
-			out.WarnFHighlight("warning: unable to create scp group commands for env: %s", err)
-			continue
+			return nil, err
 		}
 
 		envC.AddCommand(groupCommands...)
@@ -70,30 +79,48 @@ func createEnvironmentSCPSubCommands(cfg *config.Config, scpOpts scp.Options) ([
 }
 
 // create an array of environment group sub-commands available to `scp env`
-func createEnvironmentGroupSCPSubCommands(env config.Environment, cfg *config.Config, scpOpts scp.Options) ([]*cobra.Command, error) {
-	path := cfg.GetPath(env)
-
-	groups, err := ansible.GetGroupsForEnvironment(path, env.Name)
-	if err != nil {
-		return nil, errors.WithMessagef(err, "error loading ansible hosts for %s", env.Name)
-	}
-
+func createEnvironmentGroupSCPSubCommands(envTree envInstances, cfg *config.Config, scpOpts scp.Options) ([]*cobra.Command, error) {
+	env := envTree.env
 	commands := make([]*cobra.Command, 0)
+	// the instances of each group, for copies between groups
+	groupInstances := envTree.instances
 
-	for _, grp := range groups {
-		instances, err := aws.ListEC2ByAnsibleGroup(env.Name, cfg.GetProfile(env.Name), grp, cfg)
-		if err != nil {
-			return nil, errors.WithMessagef(err, "error fetching ec2: %+v", env)
-		}
-
-		if len(instances) == 0 {
-			// no instances available so skip creating a command
-			continue
-		}
+	for _, grp := range envTree.groups {
+		instances := groupInstances[grp]
 
+		grpName, grpInstances := grp, instances
 		grpC := &cobra.Command{
-			Use:   grp,
+			Use:   grp + " [<n>:<fromFile> <group> <m>:<toFile>]",
 			Short: fmt.Sprintf("scp on %s %s", env.Name, grp),
+			Long: fmt.Sprintf("scp on %s %s\n"+
+				"With args <n>:<fromFile> <group> <m>:<toFile>, copies <fromFile> on instance <n> of %s "+
+				"to <toFile> on instance <m> of <group>, streaming it via this machine (or with `--direct`, between the instances).",
+				env.Name, grp, grp,
+			),
+			Args: func(cmd *cobra.Command, args []string) error {
+				if len(args) != 0 && len(args) != 3 {
+					return fmt.Errorf("want <n>:<fromFile> <group> <m>:<toFile> (or an instance number), not %q", args)
+				}
+				return nil
+			},
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if len(args) == 0 {
+					return cmd.Help()
+				}
+				src, srcFile, err := parseInstancePath(grpName, grpInstances, args[0])
+				if err != nil {
+					return err
+				}
+				dstInstances, ok := groupInstances[args[1]]
+				if !ok {
+					return fmt.Errorf("no group %q (with instances) in %s", args[1], env.Name)
+				}
+				dst, target, err := parseInstancePath(args[1], dstInstances, args[2])
+				if err != nil {
+					return err
+				}
+				return scp.CopyBetween(cfg, env, src, []string{srcFile}, dst, target, scpOpts)
+			},
 		}
 
 		instanceCommands, err := createInstanceSCPSubCommands(grp, cfg, env, instances, scpOpts)
@@ -108,6 +135,19 @@ func createEnvironmentGroupSCPSubCommands(env config.Environment, cfg *config.Co
 	return commands, nil
 }
 
+// parseInstancePath returns the instance and path of `arg` (`<n>:<path>`, where n is one-based) in the group
+func parseInstancePath(grp string, instances []aws.EC2Result, arg string) (aws.EC2Result, string, error) {
+	index, p, ok := strings.Cut(arg, ":")
+	n, err := strconv.Atoi(index)
+	if !ok || err != nil || p == "" {
+		return aws.EC2Result{}, "", fmt.Errorf("want <n>:<path>, not %q", arg)
+	}
+	if n < 1 || n > len(instances) {
+		return aws.EC2Result{}, "", fmt.Errorf("no instance %d in %s (there are %d)", n, grp, len(instances))
+	}
+	return instances[n-1], p, nil
+}
+
 // create an array of instance sub-commands available to `scp env group`
 func createInstanceSCPSubCommands(grp string, cfg *config.Config, env config.Environment, instances []aws.EC2Result, scpOpts scp.Options) ([]*cobra.Command, error) {
 	commands := make([]*cobra.Command, 0)
@@ -115,6 +155,7 @@ func createInstanceSCPSubCommands(grp string, cfg *config.Config, env config.Env
 	for i, instance := range instances {
 		e := env
 		inst := instance
+		instanceNum := i
 		index := strconv.Itoa(i + 1)
 
 		instanceC := &cobra.Command{
@@ -123,12 +164,35 @@ func createInstanceSCPSubCommands(grp string, cfg *config.Config, env config.Env
 			Long: fmt.Sprintf("scp on %q %q (%s) (%s) args: <srcFiles...> <destFile>\n"+
 				"By default, <srcFiles> are local and pushed to <remoteHost>:<destFile>, "+
 				"(but if `scp --pull` was used, <remoteHost>:<srcFiles> are pulled).\n"+
-				"The remote files can be relative paths (rel. to your remote home dir).",
+				"The remote files can be relative paths (rel. to your remote home dir).\n"+
+				"With `--to` or `--all`, copies to/from several instances concurrently: "+
+				"pulls go into a dir per instance under <destFile> (e.g. <destFile>/publishing-2).\n"+
+				"A <srcFile> (for pushes) or <destFile> (for pulls) of - is stdin or stdout. "+
+				"With `--clipboard`, give only the remote file, which is pulled to (or pushed from) the clipboard.",
 				grp, inst.Name, inst.IPAddress, inst.InstanceId,
 			),
-			Args: cobra.MinimumNArgs(2),
+			Args: cobra.MinimumNArgs(1),
 			RunE: func(cmd *cobra.Command, args []string) error {
-				return scp.Launch(cfg, e, inst, scpOpts, args[:len(args)-1], args[len(args)-1])
+				if *scpOpts.IsClipboard {
+					if *scpOpts.IsPull {
+						return scp.Launch(cfg, e, instances, instanceNum, scpOpts, args, "")
+					}
+					if len(args) != 1 {
+						return fmt.Errorf("with --clipboard, give only the remote file to write, not %q", args)
+					}
+					return scp.Launch(cfg, e, instances, instanceNum, scpOpts, nil, args[0])
+				}
+				if len(args) < 2 {
+					return fmt.Errorf("requires at least 2 arg(s), only received %d", len(args))
+				}
+				return scp.Launch(cfg, e, instances, instanceNum, scpOpts, args[:len(args)-1], args[len(args)-1])
+			},
+			// with --pull, the first arg is remote, so is completed from the instance's files
+			ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+				if !*scpOpts.IsPull || len(args) > 0 {
+					return nil, cobra.ShellCompDirectiveDefault
+				}
+				return remotefs.Complete(cfg, e, inst, toComplete), cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
 			},
 		}
 
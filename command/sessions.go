@@ -0,0 +1,93 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/out"
+	"github.com/ONSdigital/dp-cli/session"
+	"github.com/spf13/cobra"
+)
+
+// sessionsCommand builds a cobra.Command to review recorded ssh sessions.
+// The command has the following structure:
+//
+//	sessions
+//	    ls
+//	    play	# <name> [--speed 2] [--idle 2s]
+func sessionsCommand(cfg *config.Config) *cobra.Command {
+	sessionsC := &cobra.Command{
+		Use:   "sessions",
+		Short: "Review recorded ssh sessions (see `dp ssh --record` and the record-sessions policy)",
+	}
+
+	sessionsC.AddCommand(sessionsListCommand(cfg), sessionsPlayCommand(cfg))
+	return sessionsC
+}
+
+func sessionsListCommand(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:     "ls",
+		Aliases: []string{"list"},
+		Short:   "List the recorded sessions",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			recordings, err := session.List(cfg.GetRecordingsDir())
+			if err != nil {
+				return err
+			}
+			if len(recordings) == 0 {
+				out.InfoFHighlight("no recorded sessions in %s", cfg.GetRecordingsDir())
+				return nil
+			}
+			fmt.Printf("%-48s %-12s %-32s %-12s %-20s %s\n", "NAME", "ENV", "INSTANCE", "USER", "STARTED", "DURATION")
+			for _, r := range recordings {
+				meta := r.Header.Session
+				instance := meta.Instance + " " + meta.InstanceID
+				duration := time.Duration(r.Header.Duration * float64(time.Second)).Round(time.Second)
+				fmt.Printf("%-48s %-12s %-32s %-12s %-20s %s\n", r.Name, meta.Environment, instance, meta.User, meta.Started.Local().Format("2006-01-02 15:04:05"), duration)
+			}
+			return nil
+		},
+	}
+}
+
+func sessionsPlayCommand(cfg *config.Config) *cobra.Command {
+	playC := &cobra.Command{
+		Use:   "play <name>",
+		Short: "Replay a recorded session (the name from `dp sessions ls`, or a path)",
+		Args:  cobra.ExactArgs(1),
+	}
+	speed := playC.Flags().Float64P("speed", "s", 1, "playback speed multiplier")
+	maxIdle := playC.Flags().Duration("idle", 2*time.Second, "shorten pauses to at most this long (0 for the recorded pauses)")
+
+	playC.RunE = func(cmd *cobra.Command, args []string) error {
+		path, err := session.Find(cfg.GetRecordingsDir(), args[0])
+		if err != nil {
+			return err
+		}
+		h, err := session.ReadHeader(path)
+		if err != nil {
+			return err
+		}
+		meta := h.Session
+		out.Highlight(out.INFO, "Replaying session on %s %s (%s) by %s, started %s", meta.Environment, meta.Instance, meta.InstanceID, meta.User, meta.Started.Local().Format(time.RFC1123))
+		if err = session.Play(path, os.Stdout, *speed, *maxIdle); err != nil {
+			return err
+		}
+		fmt.Println()
+		out.Highlight(out.INFO, "End of session, ended %s", meta.Ended.Local().Format(time.RFC1123))
+		return nil
+	}
+	playC.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		recordings, _ := session.List(cfg.GetRecordingsDir())
+		var names []string
+		for _, r := range recordings {
+			names = append(names, r.Name)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+	return playC
+}
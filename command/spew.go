@@ -1,34 +1,106 @@
 package command
 
 import (
+	"os"
+	"strings"
+
 	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/doctor"
 	"github.com/ONSdigital/dp-cli/out"
 
 	"github.com/spf13/cobra"
 )
 
-func spew() *cobra.Command {
+func spew(cfg *config.Config) *cobra.Command {
 	command := &cobra.Command{
 		Use:   "spew",
 		Short: "Log out some useful debugging info",
 	}
 
-	command.AddCommand(logConfig())
+	command.AddCommand(logConfig(), logEnv(cfg), logDoctor())
 	return command
 }
 
 func logConfig() *cobra.Command {
-	return &cobra.Command{
+	command := &cobra.Command{
 		Use:   "config",
-		Short: "spew out your dp-cli config",
+		Short: "spew out your dp-cli config (sensitive values are redacted)",
+	}
+	reveal := command.Flags().Bool("reveal", false, "show sensitive values (tokens, URL credentials) unredacted")
+
+	command.RunE = func(cmd *cobra.Command, args []string) error {
+		data, err := config.Dump(*reveal)
+		if err != nil {
+			return err
+		}
+
+		out.InfoFHighlight("configuration:\n%s", string(data))
+		return nil
+	}
+	return command
+}
+
+// logEnv spews the resolved config paths, AWS profile mapping and inventory locations
+func logEnv(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "env",
+		Short: "spew out resolved paths, AWS profiles and inventory locations",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			data, err := config.Dump()
-			if err != nil {
-				return err
+			out.InfoFHighlight("config file: %s", config.GetConfigPath())
+
+			out.Info("paths:")
+			for _, p := range []struct{ name, path string }{
+				{"dp-setup-path", cfg.DPSetupPath},
+				{"dp-ci-path", cfg.DPCIPath},
+				{"dp-nisra-path", cfg.NisraPath},
+				{"dp-hierarchy-builder-path", cfg.DPHierarchyBuilderPath},
+				{"dp-code-list-scripts-path", cfg.DPCodeListScriptsPath},
+				{"dp-cli-path", cfg.DPCLIPath},
+			} {
+				out.InfoFHighlight("  %-26s %s %s", p.name, p.path, pathState(p.path))
+			}
+
+			out.Info("aws env vars:")
+			for _, name := range []string{"AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION"} {
+				out.InfoFHighlight("  %-26s %s", name, os.Getenv(name))
 			}
 
-			out.InfoFHighlight("configuration:\n%s", string(data))
+			out.Info("environments:")
+			for _, env := range cfg.Environments {
+				inventory := cfg.GetAnsibleDirectory(env)
+				out.Highlight(out.GetLevel(env), "  %-26s profile: %s  tags: [%s]  inventory: %s %s",
+					env.Name, cfg.GetProfile(env.Name), strings.Join(env.Tags, ","), inventory, pathState(inventory))
+			}
 			return nil
 		},
 	}
 }
+
+// logDoctor spews the locations and versions of the tools dp-cli runs
+func logDoctor() *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "spew out the locations and versions of the tools dp-cli runs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, tool := range doctor.Tools {
+				info := tool.Inspect()
+				if info.Path == "" {
+					out.WarnFHighlight("%-24s not found", info.Name)
+					continue
+				}
+				out.InfoFHighlight("%-24s %s %s", info.Name, info.Path, info.Version)
+			}
+			return nil
+		},
+	}
+}
+
+func pathState(path string) string {
+	if path == "" {
+		return "(unset)"
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "(missing)"
+	}
+	return ""
+}
@@ -5,12 +5,9 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/ONSdigital/dp-cli/ansible"
 	"github.com/ONSdigital/dp-cli/aws"
 	"github.com/ONSdigital/dp-cli/config"
-	"github.com/ONSdigital/dp-cli/out"
 	"github.com/ONSdigital/dp-cli/ssh"
-	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -25,22 +22,31 @@ func sshCommand(cfg *config.Config) (*cobra.Command, error) {
 	sshC := &cobra.Command{
 		Use:   "ssh",
 		Short: "Access an environment using ssh",
+		// errors after the args are checked are from ssh (e.g. a remote exit code), so do not show usage
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			cmd.SilenceUsage = true
+		},
 	}
 
 	sshOpts := ssh.SSHOpts{
-		PortArgs:       sshC.PersistentFlags().StringSliceP("port", "p", nil, "Optional port forwarding rule[s] of the form `[<local>:[<host>:]]<remote>` e.g. '15900', '8080:15900', '15900,8080:15900', '1234:hostX:4321'"),
+		PortArgs:       sshC.PersistentFlags().StringSliceP("port", "p", nil, "Optional port forwarding rule[s] of the form `[<local>:[<host>:]]<remote>` or `[<local>:]<service>` e.g. '15900', '8080:15900', '15900,8080:15900', '1234:hostX:4321', '8080:[::1]:80', '2375:/var/run/docker.sock', 'dataset-api'"),
+		RemotePortArgs: sshC.PersistentFlags().StringSliceP("remote-forward", "R", nil, "Optional remote port forwarding rule[s] (remote listens, forwards to your machine) of the form `[<remote>:[<host>:]]<local>` e.g. '9000:3000'"),
+		SocksArg:       sshC.PersistentFlags().String("socks", "", "Optional SOCKS proxy on local `[<bind_address>:]<port>` e.g. '1080' (for browsing internal admin UIs)"),
+		JumpHostArg:    sshC.PersistentFlags().StringP("jump", "J", "", "Optional jump host[s] to connect via, of the form `[<user>@]<host>[:<port>][,...]` (overrides ssh.cfg's ProxyCommand)"),
 		VerboseCount:   sshC.PersistentFlags().CountP("verbose", "v", "verbose - increase ssh verbosity"),
 		QuietFlag:      sshC.PersistentFlags().BoolP("quiet", "q", false, "quiet"),
 		InstanceNumMax: sshC.PersistentFlags().IntP("to", "t", -1, "max instance number to run against (0 for highest)"),
+		AssumeYes:      assumeYes,
+		ScriptArg:      sshC.PersistentFlags().StringP("script", "s", "", "run the local script `file` on the instance[s] (streamed over stdin), args after `--` are passed to it"),
+		ExitPolicy:     sshC.PersistentFlags().String("exit-code", ssh.EXIT_FIRST, "with --to, exit with the code of the `first` failure (stopping there), the `max` code, or the `count` of failures"),
+		SudoFlag:       sshC.PersistentFlags().Bool("sudo", false, "run the --script with sudo"),
+		RecordFlag:     sshC.PersistentFlags().Bool("record", false, "record the session (see dp sessions), always on when the environment policy has record-sessions"),
 	}
 
 	environmentCommands, err := createEnvironmentSubCommands(cfg, sshOpts)
 	if err != nil {
 		return nil, err
 	}
-	if len(environmentCommands) == 0 {
-		out.Warn("Warning: No subcommands found for envs - missing envs in config?")
-	}
 
 	sshC.AddCommand(environmentCommands...)
 	return sshC, nil
@@ -50,16 +56,15 @@ func sshCommand(cfg *config.Config) (*cobra.Command, error) {
 func createEnvironmentSubCommands(cfg *config.Config, opts ssh.SSHOpts) ([]*cobra.Command, error) {
 	commands := make([]*cobra.Command, 0)
 
-	for _, env := range cfg.Environments {
+	for _, envTree := range getInstanceTree(cfg) {
 		envC := &cobra.Command{
-			Use:   env.Name,
-			Short: "ssh to " + env.Name,
+			Use:   envTree.env.Name,
+			Short: "ssh to " + envTree.env.Name,
 		}
 
-		groupCommands, err := createEnvironmentGroupSubCommands(env, cfg, opts)
+		groupCommands, err := createEnvironmentGroupSubCommands(envTree, cfg, opts)
 		if err != nil {
-			out.WarnFHighlight("warning: unable to create ssh group commands for env: %s", err)
-			continue
+			return nil, err
 		}
 
 		envC.AddCommand(groupCommands...)
@@ -69,28 +74,13 @@ func createEnvironmentSubCommands(cfg *config.Config, opts ssh.SSHOpts) ([]*cobr
 }
 
 // create a array of environment group sub commands available to ssh to.
-func createEnvironmentGroupSubCommands(env config.Environment, cfg *config.Config, opts ssh.SSHOpts) ([]*cobra.Command, error) {
-	path := cfg.GetPath(env)
-
-	groups, err := ansible.GetGroupsForEnvironment(path, env.Name)
-	if err != nil {
-		return nil, errors.WithMessagef(err, "error loading ansible hosts for %s", env.Name)
-	}
-
+func createEnvironmentGroupSubCommands(envTree envInstances, cfg *config.Config, opts ssh.SSHOpts) ([]*cobra.Command, error) {
+	env := envTree.env
 	commands := make([]*cobra.Command, 0)
 	seenIP := make(map[string]bool)
 
-	for _, grp := range groups {
-		instances, err := aws.ListEC2ByAnsibleGroup(env.Name, cfg.GetProfile(env.Name), grp, cfg)
-		if err != nil {
-			return nil, errors.WithMessagef(err, "error fetching ec2: %+v", env)
-		}
-
-		if len(instances) == 0 {
-			// no instances available so skip creating a command
-			continue
-		}
-
+	for _, grp := range envTree.groups {
+		instances := envTree.instances[grp]
 		grpC := &cobra.Command{
 			Use:   grp,
 			Short: fmt.Sprintf("ssh to %s %s", env.Name, grp),
@@ -0,0 +1,41 @@
+package command
+
+import (
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/scp"
+	"github.com/spf13/cobra"
+)
+
+// syncCommand builds a cobra.Command to sync a dir to (or from) an instance using rsync.
+// The command has the following structure:
+//
+//	sync			# [--pull] [--checksum] [--delete] [--exclude glob] [--dry-run]
+//	    environment	# sandbox
+//	        group		# publishing
+//	            instance	# 1 <localDir> <remoteDir>
+func syncCommand(cfg *config.Config) *cobra.Command {
+	syncC := &cobra.Command{
+		Use:   "sync",
+		Short: "Sync a local dir to (or `--pull` from) a remote dir using rsync, only copying changed files",
+		Long: "Sync a local dir to (or `--pull` from) a remote dir using rsync, only copying changed files.\n" +
+			"The contents of the source dir are synced into the target dir. Files are compared by size and mtime (or `--checksum`).\n" +
+			"The remote dir can be a relative path (rel. to your remote home dir).",
+	}
+	opts := scp.SyncOptions{
+		IsPull:      syncC.PersistentFlags().Bool("pull", false, "pull the remote dir into the local dir [default: push]"),
+		IsChecksum:  syncC.PersistentFlags().BoolP("checksum", "c", false, "compare files by checksum [default: size and mtime]"),
+		IsDeleting:  syncC.PersistentFlags().Bool("delete", false, "delete files in the target dir which are not in the source dir"),
+		IsDryRun:    syncC.PersistentFlags().BoolP("dry-run", "n", false, "list the changes, without making them"),
+		IsConfirmed: syncC.PersistentFlags().Bool("confirm-non-sensitive", false, "declare: no sensitive files being copied"),
+		Excludes:    syncC.PersistentFlags().StringArray("exclude", nil, "exclude files matching the rsync `glob` (repeatable) e.g. '*.log', '.git/'"),
+		Verbosity:   syncC.PersistentFlags().CountP("verbose", "v", "verbose - increase rsync verbosity"),
+		AssumeYes:   assumeYes,
+	}
+
+	syncC.AddCommand(createInstanceTreeSubCommands(cfg, "sync with", "<localDir> <remoteDir>", cobra.ExactArgs(2),
+		func(cmd *cobra.Command, env config.Environment, grp string, instances []aws.EC2Result, instanceNum int, args []string) error {
+			return scp.Sync(cfg, env, instances[instanceNum], opts, args[0], args[1])
+		})...)
+	return syncC
+}
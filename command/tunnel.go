@@ -0,0 +1,148 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/out"
+	"github.com/ONSdigital/dp-cli/ssh"
+	"github.com/ONSdigital/dp-cli/tunnel"
+	"github.com/spf13/cobra"
+)
+
+// tunnelCommand builds a cobra.Command to manage background port-forwards to an environment.
+// The command has the following structure:
+//
+//	tunnel
+//	    open			# -p 27017:mongo:27017 [--name mongo]
+//	        environment	# sandbox
+//	            group		# publishing
+//	                instance	# 1
+//	    ls
+//	    close			# <name...> | --all
+func tunnelCommand(cfg *config.Config) *cobra.Command {
+	tunnelC := &cobra.Command{
+		Use:   "tunnel",
+		Short: "Manage background ssh port-forwards (tunnels) to an environment",
+	}
+
+	tunnelC.AddCommand(tunnelOpenCommand(cfg), tunnelListCommand(cfg), tunnelCloseCommand(cfg), tunnelSuperviseCommand(cfg))
+	return tunnelC
+}
+
+func tunnelOpenCommand(cfg *config.Config) *cobra.Command {
+	openC := &cobra.Command{
+		Use:   "open",
+		Short: "Open a named tunnel in the background (reconnects if dropped)",
+	}
+	portArgs := openC.PersistentFlags().StringSliceP("port", "p", nil, "Port forwarding rule[s] of the form `[<local>:[<host>:]]<remote>` or `[<local>:]<service>` e.g. '15900', '27017:mongo:27017', 'zebedee'")
+	serviceArgs := openC.PersistentFlags().StringSliceP("service", "s", nil, "Forward the named service[s] (from `services` in config) e.g. 'zebedee,dataset-api'")
+	name := openC.PersistentFlags().StringP("name", "n", "", "name of the tunnel (default: <env>-<group>-<instance>)")
+
+	openC.AddCommand(createInstanceTreeSubCommands(cfg, "tunnel to", "", cobra.NoArgs,
+		func(cmd *cobra.Command, env config.Environment, grp string, instances []aws.EC2Result, instanceNum int, args []string) error {
+			instance := instances[instanceNum]
+			ports := append(append([]string{}, *portArgs...), *serviceArgs...)
+			sshArgs, profile, err := ssh.TunnelArgs(cfg, env, instance, ports)
+			if err != nil {
+				return err
+			}
+
+			t := tunnel.Tunnel{
+				Name:        *name,
+				Environment: env.Name,
+				Target:      fmt.Sprintf("%s %d (%s)", grp, instanceNum+1, instance.InstanceId),
+				Ports:       ports,
+				Dir:         cfg.GetAnsibleDirectory(env),
+				Args:        sshArgs,
+				Profile:     profile,
+			}
+			if t.Name == "" {
+				t.Name = fmt.Sprintf("%s-%s-%d", env.Name, grp, instanceNum+1)
+			}
+
+			out.Highlight(out.GetLevel(env), "opening tunnel %s to %s %s [%s]", t.Name, env.Name, t.Target, strings.Join(t.Ports, ", "))
+			return tunnel.Open(cfg, t, []string{"tunnel", "supervise"})
+		})...)
+	return openC
+}
+
+func tunnelListCommand(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:     "ls",
+		Aliases: []string{"list"},
+		Short:   "List the open tunnels",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tunnels, err := tunnel.List(cfg)
+			if err != nil {
+				return err
+			}
+			if len(tunnels) == 0 {
+				out.Info("no open tunnels")
+				return nil
+			}
+			fmt.Printf("%-24s %-8s %-28s %-40s %-10s %s\n", "NAME", "PID", "PORTS", "TARGET", "UPTIME", "RESTARTS")
+			for _, t := range tunnels {
+				target := t.Environment + " " + t.Target
+				fmt.Printf("%-24s %-8d %-28s %-40s %-10s %d\n", t.Name, t.PID, strings.Join(t.Ports, ","), target, t.Uptime(), t.Restarts)
+			}
+			return nil
+		},
+	}
+}
+
+func tunnelCloseCommand(cfg *config.Config) *cobra.Command {
+	closeC := &cobra.Command{
+		Use:   "close <name...>",
+		Short: "Close the named tunnel[s] (or `--all`)",
+	}
+	isAll := closeC.Flags().BoolP("all", "a", false, "close all open tunnels")
+
+	closeC.RunE = func(cmd *cobra.Command, args []string) error {
+		if *isAll {
+			tunnels, err := tunnel.List(cfg)
+			if err != nil {
+				return err
+			}
+			for _, t := range tunnels {
+				args = append(args, t.Name)
+			}
+		} else if len(args) == 0 {
+			return errors.New("give the name[s] of the tunnel[s] to close (or `--all`)")
+		}
+
+		for _, name := range args {
+			if err := tunnel.Close(cfg, name); err != nil {
+				return err
+			}
+			out.InfoFHighlight("closed tunnel %s", name)
+		}
+		return nil
+	}
+	closeC.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		tunnels, _ := tunnel.List(cfg)
+		var names []string
+		for _, t := range tunnels {
+			names = append(names, t.Name)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+	return closeC
+}
+
+// tunnelSuperviseCommand is run in the background by `tunnel open`
+func tunnelSuperviseCommand(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:    "supervise <name>",
+		Short:  "Keep the named tunnel connected (run by `tunnel open`)",
+		Hidden: true,
+		Args:   cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return tunnel.Supervise(cfg, args[0])
+		},
+	}
+}
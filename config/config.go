@@ -28,23 +28,34 @@ var httpClient = &http.Client{
 }
 
 type Config struct {
-	CMD                    CMD           `yaml:"cmd"`
-	Environments           []Environment `yaml:"environments"`
-	SSHUser                *string       `yaml:"ssh-user"`
-	UserName               *string       `yaml:"user-name"`
-	IPAddress              *string       `yaml:"ip-address"`
-	HttpOnly               *bool         `yaml:"http-only"`
-	DPSetupPath            string        `yaml:"dp-setup-path"`
-	NisraPath              string        `yaml:"dp-nisra-path"`
-	DPCIPath               string        `yaml:"dp-ci-path"`
-	DPHierarchyBuilderPath string        `yaml:"dp-hierarchy-builder-path"`
-	DPCodeListScriptsPath  string        `yaml:"dp-code-list-scripts-path"`
-	DPCLIPath              string        `yaml:"dp-cli-path"`
+	CMD                    CMD                `yaml:"cmd"`
+	Environments           []Environment      `yaml:"environments"`
+	SSHUser                *string            `yaml:"ssh-user"`
+	UserName               *string            `yaml:"user-name"`
+	IPAddress              *string            `yaml:"ip-address"`
+	HttpOnly               *bool              `yaml:"http-only"`
+	DPSetupPath            string             `yaml:"dp-setup-path"`
+	NisraPath              string             `yaml:"dp-nisra-path"`
+	DPCIPath               string             `yaml:"dp-ci-path"`
+	DPHierarchyBuilderPath string             `yaml:"dp-hierarchy-builder-path"`
+	DPCodeListScriptsPath  string             `yaml:"dp-code-list-scripts-path"`
+	DPCLIPath              string             `yaml:"dp-cli-path"`
+	PolicyPresets          map[string]Policy  `yaml:"policy-presets"`
+	GitHubToken            string             `yaml:"github-token" sensitive:"secret"`
+	PluginsDir             string             `yaml:"plugins-dir"`
+	Aliases                map[string]string  `yaml:"aliases"`
+	RuntimeDir             string             `yaml:"runtime-dir"`
+	Services               map[string]Service `yaml:"services"`
+	RecordingsDir          string             `yaml:"recordings-dir"`
+	PullAuditFile          string             `yaml:"pull-audit-file"`
+	TransfersDir           string             `yaml:"transfers-dir"`
+	SCPBackend             string             `yaml:"scp-backend"`
+	CleanConfirm           string             `yaml:"clean-confirm"`
 }
 
 type CMD struct {
-	MongoURL    string   `yaml:"mongo-url"`
-	Neo4jURL    string   `yaml:"neo4j-url"`
+	MongoURL    string   `yaml:"mongo-url" sensitive:"url"`
+	Neo4jURL    string   `yaml:"neo4j-url" sensitive:"url"`
 	MongoDBs    []string `yaml:"mongo-dbs"`
 	Hierarchies []string `yaml:"hierarchies"`
 	Codelists   []string `yaml:"codelists"`
@@ -52,11 +63,14 @@ type CMD struct {
 
 // Environment represents an environment
 type Environment struct {
-	Name       string     `yaml:"name"`
-	Profile    string     `yaml:"profile"`
-	SSHUser    string     `yaml:"ssh-user"`
-	Tags       []string   `yaml:"tags"`
-	ExtraPorts ExtraPorts `yaml:"extra-ports"`
+	Name       string             `yaml:"name"`
+	Profile    string             `yaml:"profile"`
+	SSHUser    string             `yaml:"ssh-user"`
+	Tags       []string           `yaml:"tags"`
+	ExtraPorts ExtraPorts         `yaml:"extra-ports"`
+	Policy     *Policy            `yaml:"policy"`
+	Services   map[string]Service `yaml:"services"`
+	resolved   *Policy
 }
 
 // ExtraPorts is a list of ports for the given Security Group
@@ -68,7 +82,7 @@ type ExtraPorts struct {
 
 // Get returns the config struct by parsing the YML file
 func Get() (*Config, error) {
-	path := getConfigPath()
+	path := GetConfigPath()
 
 	b, err := os.ReadFile(path)
 	if err != nil {
@@ -80,7 +94,12 @@ func Get() (*Config, error) {
 		return nil, fmt.Errorf("cannot parse %q: %w", path, err)
 	}
 
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("bad config in %q: %w", path, err)
+	}
+
 	cfg.expandPaths()
+	cfg.resolvePolicies()
 
 	// if compile-time templatePath does not exist, or dp-cli-path set in config
 	if _, err = os.Stat(project_generation.GetTemplatePath()); os.IsNotExist(err) || cfg.DPCLIPath != "" {
@@ -99,6 +118,11 @@ func (cfg *Config) expandPaths() {
 	cfg.NisraPath = expandPath(cfg.NisraPath)
 	cfg.DPCodeListScriptsPath = expandPath(cfg.DPCodeListScriptsPath)
 	cfg.DPCLIPath = expandPath(cfg.DPCLIPath)
+	cfg.PluginsDir = expandPath(cfg.PluginsDir)
+	cfg.RuntimeDir = expandPath(cfg.RuntimeDir)
+	cfg.RecordingsDir = expandPath(cfg.RecordingsDir)
+	cfg.PullAuditFile = expandPath(cfg.PullAuditFile)
+	cfg.TransfersDir = expandPath(cfg.TransfersDir)
 }
 
 func expandPath(path string) string {
@@ -109,7 +133,66 @@ func expandPath(path string) string {
 	return path
 }
 
-func getConfigPath() (path string) {
+// GetRuntimeDir returns (creating it, if needed) the `sub` dir of the dir for dp-cli state:
+// `runtime-dir` in config, else `$XDG_RUNTIME_DIR/dp-cli`, else `~/.dp-cli/run`
+func (cfg Config) GetRuntimeDir(sub string) (string, error) {
+	dir := cfg.RuntimeDir
+	if dir == "" {
+		if xdg := os.Getenv("XDG_RUNTIME_DIR"); xdg != "" {
+			dir = filepath.Join(xdg, "dp-cli")
+		} else {
+			dir = expandPath("~/.dp-cli/run")
+		}
+	}
+	dir = filepath.Join(dir, sub)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("cannot create runtime dir %q: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// GetRecordingsDir returns the dir of ssh session recordings: `recordings-dir` in config, else `~/.dp-cli/recordings`
+func (cfg Config) GetRecordingsDir() string {
+	if cfg.RecordingsDir != "" {
+		return cfg.RecordingsDir
+	}
+	return expandPath("~/.dp-cli/recordings")
+}
+
+// GetPullAuditFile returns the file that pull declarations are recorded in: `pull-audit-file` in config, else `~/.dp-cli/pull-audit.jsonl`
+func (cfg Config) GetPullAuditFile() string {
+	if cfg.PullAuditFile != "" {
+		return cfg.PullAuditFile
+	}
+	return expandPath("~/.dp-cli/pull-audit.jsonl")
+}
+
+// GetTransfersDir returns the dir of the manifests of resumable transfers: `transfers-dir` in config, else `~/.dp-cli/transfers`
+func (cfg Config) GetTransfersDir() string {
+	if cfg.TransfersDir != "" {
+		return cfg.TransfersDir
+	}
+	return expandPath("~/.dp-cli/transfers")
+}
+
+// GetSCPBackend returns how `dp scp` copies files: `scp-backend` in config, else `scp`
+func (cfg Config) GetSCPBackend() string {
+	if cfg.SCPBackend != "" {
+		return cfg.SCPBackend
+	}
+	return "scp"
+}
+
+// GetCleanConfirm returns how `dp clean` is confirmed (one of CONFIRM_*): `clean-confirm` in config, else none
+func (cfg Config) GetCleanConfirm() string {
+	if cfg.CleanConfirm != "" {
+		return cfg.CleanConfirm
+	}
+	return CONFIRM_NONE
+}
+
+// GetConfigPath returns the path of the config file (`DP_CLI_CONFIG` or the default)
+func GetConfigPath() (path string) {
 	path = os.Getenv("DP_CLI_CONFIG")
 	if len(path) == 0 {
 		path = expandPath("~/.dp-cli-config.yml")
@@ -117,12 +200,17 @@ func getConfigPath() (path string) {
 	return
 }
 
-func Dump() ([]byte, error) {
+// Dump returns the config as YAML - with sensitive values redacted unless `reveal`
+func Dump(reveal bool) ([]byte, error) {
 	c, err := Get()
 	if err != nil {
 		return nil, err
 	}
 
+	if !reveal {
+		return c.Redacted()
+	}
+
 	data, err := yaml.Marshal(c)
 	if err != nil {
 		return nil, err
@@ -188,46 +276,6 @@ func (env Environment) hasTag(tag string) bool {
 	return false
 }
 
-func (cfg Config) hasTag(env, tag string) bool {
-	for _, e := range cfg.Environments {
-		if e.Name == env {
-			return e.hasTag(tag)
-		}
-	}
-	return false
-}
-
-func (cfg Config) IsAWSA(env string) bool {
-	return cfg.hasTag(env, TAG_AWSA)
-}
-func (env Environment) IsAWSA() bool {
-	return env.hasTag(TAG_AWSA)
-}
-func (cfg Config) IsCI(env string) bool {
-	return cfg.hasTag(env, TAG_CI)
-}
-func (env Environment) IsCI() bool {
-	return env.hasTag(TAG_CI)
-}
-func (cfg Config) IsLive(env string) bool {
-	return cfg.hasTag(env, TAG_LIVE)
-}
-func (env Environment) IsLive() bool {
-	return env.hasTag(TAG_LIVE)
-}
-func (cfg Config) IsNisra(env string) bool {
-	return cfg.hasTag(env, TAG_NISRA)
-}
-func (env Environment) IsNisra() bool {
-	return env.hasTag(TAG_NISRA)
-}
-func (cfg Config) IsSecure(env string) bool {
-	return cfg.hasTag(env, TAG_SECURE)
-}
-func (env Environment) IsSecure() bool {
-	return env.hasTag(TAG_SECURE)
-}
-
 func (cfg Config) GetProfile(env string) string {
 	for _, e := range cfg.Environments {
 		if e.Name == env {
@@ -239,23 +287,3 @@ func (cfg Config) GetProfile(env string) string {
 	}
 	return "noEnv"
 }
-
-func (cfg Config) GetPath(env Environment) string {
-	if env.IsCI() {
-		return cfg.DPCIPath
-	}
-	if env.IsNisra() {
-		return cfg.NisraPath
-	}
-	return cfg.DPSetupPath
-}
-
-func (cfg Config) GetAnsibleDirectory(env Environment) string {
-	if env.IsCI() {
-		return filepath.Join(cfg.DPCIPath, "ansible")
-	}
-	if env.IsNisra() {
-		return filepath.Join(cfg.NisraPath, "ansible")
-	}
-	return filepath.Join(cfg.DPSetupPath, "ansible")
-}
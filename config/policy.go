@@ -0,0 +1,481 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// inventories name the repos (from the config file paths) that hold an environment's ansible inventory
+const (
+	INVENTORY_DP_SETUP = "dp-setup"
+	INVENTORY_DP_CI    = "dp-ci"
+	INVENTORY_NISRA    = "dp-nisra"
+)
+
+// ip-selection strategies choose which EC2 address is reported for an instance
+const (
+	IP_PRIVATE = "private"
+	IP_PUBLIC  = "public"
+)
+
+// ssh-targets choose how ssh/scp address an instance (via ssh.cfg)
+const (
+	SSH_TARGET_INSTANCE_ID = "instance-id" // via SSM, needs AWS_PROFILE
+	SSH_TARGET_IP          = "ip"
+)
+
+// security-group targets are the SGs that `dp remote allow/deny` change
+const (
+	SG_BASTION           = "bastion"
+	SG_PUBLISHING_ELB    = "publishing-elb"
+	SG_WEB_ELB           = "web-elb"
+	SG_CANTABULAR_UI_ELB = "cantabular-ui-elb"
+	SG_CONCOURSE_WEB     = "concourse-web"
+	SG_CONCOURSE_WORKER  = "concourse-worker"
+)
+
+// severities set the colour of output for an environment
+const (
+	SEVERITY_INFO  = "info"
+	SEVERITY_WARN  = "warn"
+	SEVERITY_ERROR = "error"
+)
+
+// confirmations are what is asked before changing an environment
+const (
+	CONFIRM_NONE      = "none"
+	CONFIRM_YES_NO    = "yes-no"
+	CONFIRM_TYPE_NAME = "type-name" // the environment name must be typed
+)
+
+// presetCompoundJoiner joins tags in the name of a preset that needs all of those tags
+const presetCompoundJoiner = "+"
+
+// Policy describes how dp-cli treats an environment.
+// Empty fields are unset, so that policies can be layered (see ResolvePolicy)
+type Policy struct {
+	Inventory             string   `yaml:"inventory,omitempty"`               // one of the INVENTORY_* repos
+	InventoryPath         string   `yaml:"inventory-path,omitempty"`          // repo path, overrides Inventory
+	AWSEnvironmentTag     string   `yaml:"aws-environment-tag,omitempty"`     // EC2/SG `Environment` tag (default: env name)
+	IPSelection           string   `yaml:"ip-selection,omitempty"`            // private or public
+	SSHTarget             string   `yaml:"ssh-target,omitempty"`              // instance-id or ip
+	SecurityGroups        []string `yaml:"security-groups,omitempty"`         // SG targets for remote allow/deny
+	ExcludeSecurityGroups []string `yaml:"exclude-security-groups,omitempty"` // SG targets removed after layering
+	PullDeclaration       *bool    `yaml:"pull-declaration,omitempty"`        // scp pulls need the legal declaration
+	PullDenyPaths         []string `yaml:"pull-deny-paths,omitempty"`         // remote path globs which cannot be pulled (added to by each layer)
+	PullMaxSize           string   `yaml:"pull-max-size,omitempty"`           // largest total size of a pull, e.g. 100MB
+	AllowDirectCopy       *bool    `yaml:"allow-direct-copy,omitempty"`       // `dp scp --direct` may forward your ssh agent to instances
+	Severity              string   `yaml:"severity,omitempty"`                // info, warn or error
+	RecordSessions        *bool    `yaml:"record-sessions,omitempty"`         // interactive ssh sessions are recorded
+	Confirm               string   `yaml:"confirm,omitempty"`                 // none, yes-no or type-name
+}
+
+// builtinPresets are the policies for the environment tags.
+// Presets named `a+b` apply (after single-tag presets) when an environment has all of those tags.
+var builtinPresets = map[string]Policy{
+	TAG_AWSA: {
+		SSHTarget: SSH_TARGET_IP,
+	},
+	TAG_CI: {
+		Inventory:         INVENTORY_DP_CI,
+		AWSEnvironmentTag: "ci",
+		SecurityGroups:    []string{SG_CONCOURSE_WEB, SG_CONCOURSE_WORKER},
+	},
+	TAG_CI + presetCompoundJoiner + TAG_AWSA: {
+		IPSelection: IP_PUBLIC,
+	},
+	TAG_LIVE: {
+		ExcludeSecurityGroups: []string{SG_PUBLISHING_ELB},
+		Severity:              SEVERITY_ERROR,
+		Confirm:               CONFIRM_TYPE_NAME,
+	},
+	TAG_NISRA: {
+		Inventory:      INVENTORY_NISRA,
+		SecurityGroups: []string{SG_CANTABULAR_UI_ELB},
+	},
+	TAG_SECURE: {
+		PullDeclaration: boolPtr(true),
+		PullDenyPaths:   []string{"/var/lib/zebedee", "*.pem", "*.key", "*.p12", "id_rsa*", "id_ed25519*"},
+		PullMaxSize:     "100MB",
+		AllowDirectCopy: boolPtr(false),
+		Severity:        SEVERITY_WARN,
+	},
+}
+
+// defaultPolicy is the base layer for every environment
+var defaultPolicy = Policy{
+	Inventory:       INVENTORY_DP_SETUP,
+	IPSelection:     IP_PRIVATE,
+	SSHTarget:       SSH_TARGET_INSTANCE_ID,
+	SecurityGroups:  []string{SG_BASTION, SG_PUBLISHING_ELB, SG_WEB_ELB},
+	PullDeclaration: boolPtr(false),
+	AllowDirectCopy: boolPtr(true),
+	Severity:        SEVERITY_INFO,
+	RecordSessions:  boolPtr(false),
+	Confirm:         CONFIRM_NONE,
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// severityRank orders severities so that presets can only escalate them
+var severityRank = map[string]int{
+	SEVERITY_INFO:  1,
+	SEVERITY_WARN:  2,
+	SEVERITY_ERROR: 3,
+}
+
+// confirmRank orders confirmations so that presets can only make them stricter
+var confirmRank = map[string]int{
+	CONFIRM_NONE:      1,
+	CONFIRM_YES_NO:    2,
+	CONFIRM_TYPE_NAME: 3,
+}
+
+// sizeRank orders sizes so that presets can only lower the pull-max-size (invalid sizes rank lowest, to fail when used)
+func sizeRank(size string) int64 {
+	n, err := ParseSize(size)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// merge overlays the set fields of `over` onto `p`.
+// When `isPreset`, a (tag) preset cannot lower the severity (or confirmation) set by an earlier tag,
+// nor allow direct copies disallowed by one
+func (p Policy) merge(over Policy, isPreset bool) Policy {
+	if over.Inventory != "" {
+		p.Inventory = over.Inventory
+	}
+	if over.InventoryPath != "" {
+		p.InventoryPath = over.InventoryPath
+	}
+	if over.AWSEnvironmentTag != "" {
+		p.AWSEnvironmentTag = over.AWSEnvironmentTag
+	}
+	if over.IPSelection != "" {
+		p.IPSelection = over.IPSelection
+	}
+	if over.SSHTarget != "" {
+		p.SSHTarget = over.SSHTarget
+	}
+	if over.SecurityGroups != nil {
+		p.SecurityGroups = over.SecurityGroups
+	}
+	if over.ExcludeSecurityGroups != nil {
+		p.ExcludeSecurityGroups = append(p.ExcludeSecurityGroups, over.ExcludeSecurityGroups...)
+	}
+	if over.PullDeclaration != nil {
+		p.PullDeclaration = over.PullDeclaration
+	}
+	if over.PullDenyPaths != nil {
+		p.PullDenyPaths = append(append([]string{}, p.PullDenyPaths...), over.PullDenyPaths...)
+	}
+	if over.PullMaxSize != "" && (!isPreset || p.PullMaxSize == "" || sizeRank(over.PullMaxSize) < sizeRank(p.PullMaxSize)) {
+		p.PullMaxSize = over.PullMaxSize
+	}
+	if over.AllowDirectCopy != nil && (!isPreset || !*over.AllowDirectCopy) {
+		p.AllowDirectCopy = over.AllowDirectCopy
+	}
+	if over.Confirm != "" && (!isPreset || confirmRank[over.Confirm] > confirmRank[p.Confirm]) {
+		p.Confirm = over.Confirm
+	}
+	if over.RecordSessions != nil {
+		p.RecordSessions = over.RecordSessions
+	}
+	if over.Severity != "" && (!isPreset || severityRank[over.Severity] > severityRank[p.Severity]) {
+		p.Severity = over.Severity
+	}
+	return p
+}
+
+// getPreset returns the preset for `name` - from the config file's `policy-presets`, else built-in
+func (cfg Config) getPreset(name string) (Policy, bool) {
+	if p, ok := cfg.PolicyPresets[name]; ok {
+		return p, true
+	}
+	p, ok := builtinPresets[name]
+	return p, ok
+}
+
+// compoundPresetNames returns the names of all `a+b` presets, sorted for a stable layering order
+func (cfg Config) compoundPresetNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, presets := range []map[string]Policy{builtinPresets, cfg.PolicyPresets} {
+		for name := range presets {
+			if strings.Contains(name, presetCompoundJoiner) && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolvePolicy layers the default policy, the presets for the env's tags (in order),
+// any matching compound presets, then the env's own `policy`
+func (cfg Config) ResolvePolicy(env Environment) Policy {
+	p := defaultPolicy
+	for _, tag := range env.Tags {
+		if preset, ok := cfg.getPreset(tag); ok {
+			p = p.merge(preset, true)
+		}
+	}
+	for _, name := range cfg.compoundPresetNames() {
+		hasAll := true
+		for _, tag := range strings.Split(name, presetCompoundJoiner) {
+			if !env.hasTag(tag) {
+				hasAll = false
+				break
+			}
+		}
+		if hasAll {
+			preset, _ := cfg.getPreset(name)
+			p = p.merge(preset, true)
+		}
+	}
+	// presets' excludes apply before the env's own policy, so that its explicit security-groups win
+	p = p.excludeSecurityGroups()
+	if env.Policy != nil {
+		p = p.merge(*env.Policy, false).excludeSecurityGroups()
+	}
+
+	if p.AWSEnvironmentTag == "" {
+		p.AWSEnvironmentTag = env.Name
+	}
+	return p
+}
+
+// excludeSecurityGroups removes the ExcludeSecurityGroups from the SecurityGroups (and clears them)
+func (p Policy) excludeSecurityGroups() Policy {
+	if len(p.ExcludeSecurityGroups) == 0 {
+		return p
+	}
+	var sgs []string
+	for _, sg := range p.SecurityGroups {
+		if !containsString(p.ExcludeSecurityGroups, sg) {
+			sgs = append(sgs, sg)
+		}
+	}
+	p.SecurityGroups = sgs
+	p.ExcludeSecurityGroups = nil
+	return p
+}
+
+// securityGroupNames are the known security-group targets
+var securityGroupNames = []string{SG_BASTION, SG_PUBLISHING_ELB, SG_WEB_ELB, SG_CANTABULAR_UI_ELB, SG_CONCOURSE_WEB, SG_CONCOURSE_WORKER}
+
+// validate returns an error for the first field of the policy with an unknown value
+func (p Policy) validate() error {
+	if p.IPSelection != "" && p.IPSelection != IP_PRIVATE && p.IPSelection != IP_PUBLIC {
+		return fmt.Errorf("unknown ip-selection %q (want %s or %s)", p.IPSelection, IP_PRIVATE, IP_PUBLIC)
+	}
+	if p.SSHTarget != "" && p.SSHTarget != SSH_TARGET_INSTANCE_ID && p.SSHTarget != SSH_TARGET_IP {
+		return fmt.Errorf("unknown ssh-target %q (want %s or %s)", p.SSHTarget, SSH_TARGET_INSTANCE_ID, SSH_TARGET_IP)
+	}
+	if _, ok := severityRank[p.Severity]; p.Severity != "" && !ok {
+		return fmt.Errorf("unknown severity %q (want %s, %s or %s)", p.Severity, SEVERITY_INFO, SEVERITY_WARN, SEVERITY_ERROR)
+	}
+	if err := validateConfirm(p.Confirm); err != nil {
+		return err
+	}
+	for _, sgs := range [][]string{p.SecurityGroups, p.ExcludeSecurityGroups} {
+		for _, sg := range sgs {
+			if !containsString(securityGroupNames, sg) {
+				return fmt.Errorf("unknown security group %q (want one of: %s)", sg, strings.Join(securityGroupNames, ", "))
+			}
+		}
+	}
+	if p.PullMaxSize != "" {
+		if _, err := ParseSize(p.PullMaxSize); err != nil {
+			return fmt.Errorf("bad pull-max-size: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateConfirm returns an error when `confirm` is set but not one of CONFIRM_*
+func validateConfirm(confirm string) error {
+	if _, ok := confirmRank[confirm]; confirm != "" && !ok {
+		return fmt.Errorf("unknown confirm %q (want %s, %s or %s)", confirm, CONFIRM_NONE, CONFIRM_YES_NO, CONFIRM_TYPE_NAME)
+	}
+	return nil
+}
+
+// validate returns an error for the first policy (in the presets, then the environments) or setting with an unknown value
+func (cfg Config) validate() error {
+	var names []string
+	for name := range cfg.PolicyPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := cfg.PolicyPresets[name].validate(); err != nil {
+			return fmt.Errorf("policy-presets %q: %w", name, err)
+		}
+	}
+	for _, env := range cfg.Environments {
+		if env.Policy == nil {
+			continue
+		}
+		if err := env.Policy.validate(); err != nil {
+			return fmt.Errorf("environment %q policy: %w", env.Name, err)
+		}
+	}
+	if err := validateConfirm(cfg.CleanConfirm); err != nil {
+		return fmt.Errorf("clean-confirm: %w", err)
+	}
+	return nil
+}
+
+// resolvePolicies stores the resolved policy in each environment
+func (cfg *Config) resolvePolicies() {
+	for i := range cfg.Environments {
+		p := cfg.ResolvePolicy(cfg.Environments[i])
+		cfg.Environments[i].resolved = &p
+	}
+}
+
+// GetPolicy returns the env's resolved policy (only built-in presets apply if not loaded via Get)
+func (env Environment) GetPolicy() Policy {
+	if env.resolved != nil {
+		return *env.resolved
+	}
+	return Config{}.ResolvePolicy(env)
+}
+
+// GetPolicy returns the resolved policy for the named environment
+func (cfg Config) GetPolicy(env string) Policy {
+	if e, ok := cfg.GetEnvironment(env); ok {
+		return cfg.ResolvePolicy(e)
+	}
+	return cfg.ResolvePolicy(Environment{Name: env})
+}
+
+// GetEnvironment returns the named environment from the config
+func (cfg Config) GetEnvironment(env string) (Environment, bool) {
+	for _, e := range cfg.Environments {
+		if e.Name == env {
+			return e, true
+		}
+	}
+	return Environment{}, false
+}
+
+// IsPublicIP is true when instances should be addressed by public IP
+func (p Policy) IsPublicIP() bool {
+	return p.IPSelection == IP_PUBLIC
+}
+
+// IsSSHByIP is true when ssh/scp should target the instance IP (rather than instance id)
+func (p Policy) IsSSHByIP() bool {
+	return p.SSHTarget == SSH_TARGET_IP
+}
+
+// NeedsPullDeclaration is true when scp pulls need the legal declaration
+func (p Policy) NeedsPullDeclaration() bool {
+	return p.PullDeclaration != nil && *p.PullDeclaration
+}
+
+// GetPullMaxBytes returns the largest total size (in bytes) of a pull, or 0 for no limit
+func (p Policy) GetPullMaxBytes() (int64, error) {
+	if p.PullMaxSize == "" {
+		return 0, nil
+	}
+	n, err := ParseSize(p.PullMaxSize)
+	if err != nil {
+		return 0, fmt.Errorf("bad pull-max-size in policy: %w", err)
+	}
+	return n, nil
+}
+
+// GetPullDenial returns the first pull-deny-paths glob which denies pulling the (absolute) remote `file`.
+// A glob denies a file when it matches the file or any dir above it, and a glob without a `/` is matched against each name in the path
+func (p Policy) GetPullDenial(file string) (glob string, isDenied bool) {
+	file = path.Clean(file)
+	for _, glob := range p.PullDenyPaths {
+		hasSlash := strings.Contains(glob, "/")
+		glob := strings.TrimSuffix(glob, "/")
+		for f := file; f != "/" && f != "." && f != ""; f = path.Dir(f) {
+			name := f
+			if !hasSlash {
+				name = path.Base(f)
+			}
+			if ok, _ := path.Match(glob, name); ok {
+				return glob, true
+			}
+		}
+	}
+	return "", false
+}
+
+// ParseSize returns the number of bytes in `size`, e.g. 512, 10KB, 100MB or 1.5GB (units are powers of 1024)
+func ParseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGT", s[n-1]); i >= 0 {
+			multiplier = int64(1) << (10 * (i + 1))
+			s = s[:n-1]
+		}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("bad size %q (use e.g. 500KB, 100MB, 2GB)", size)
+	}
+	return int64(f * float64(multiplier)), nil
+}
+
+// IsDirectCopyAllowed is true when copies between instances may go directly (forwarding your ssh agent to them)
+func (p Policy) IsDirectCopyAllowed() bool {
+	return p.AllowDirectCopy == nil || *p.AllowDirectCopy
+}
+
+// IsRecordingSessions is true when interactive ssh sessions must be recorded
+func (p Policy) IsRecordingSessions() bool {
+	return p.RecordSessions != nil && *p.RecordSessions
+}
+
+// getInventoryPath returns the repo path for the policy's inventory
+func (cfg Config) getInventoryPath(p Policy) string {
+	if p.InventoryPath != "" {
+		return expandPath(p.InventoryPath)
+	}
+	switch p.Inventory {
+	case INVENTORY_DP_CI:
+		return cfg.DPCIPath
+	case INVENTORY_NISRA:
+		return cfg.NisraPath
+	default:
+		return cfg.DPSetupPath
+	}
+}
+
+func (cfg Config) GetPath(env Environment) string {
+	if env.resolved != nil {
+		return cfg.getInventoryPath(*env.resolved)
+	}
+	return cfg.getInventoryPath(cfg.ResolvePolicy(env))
+}
+
+func (cfg Config) GetAnsibleDirectory(env Environment) string {
+	return filepath.Join(cfg.GetPath(env), "ansible")
+}
+
+func containsString(list []string, s string) bool {
+	for _, each := range list {
+		if each == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResolvePolicy(t *testing.T) {
+	Convey("Given a config with the usual environments", t, func() {
+		cfg := Config{
+			DPSetupPath: "/src/dp-setup",
+			DPCIPath:    "/src/dp-ci",
+			NisraPath:   "/src/dp-nisra",
+			Environments: []Environment{
+				{Name: "sandbox"},
+				{Name: "prod", Tags: []string{TAG_LIVE, TAG_SECURE}},
+				{Name: "ci", Tags: []string{TAG_CI}},
+				{Name: "old-ci", Tags: []string{TAG_CI, TAG_AWSA}},
+				{Name: "nisra-prod", Tags: []string{TAG_NISRA, TAG_LIVE, TAG_SECURE}},
+			},
+		}
+
+		Convey("When an untagged environment is resolved", func() {
+			p := cfg.GetPolicy("sandbox")
+
+			Convey("Then the default policy should apply", func() {
+				So(p.AWSEnvironmentTag, ShouldEqual, "sandbox")
+				So(p.IsPublicIP(), ShouldBeFalse)
+				So(p.IsSSHByIP(), ShouldBeFalse)
+				So(p.NeedsPullDeclaration(), ShouldBeFalse)
+				So(p.IsDirectCopyAllowed(), ShouldBeTrue)
+				So(p.Severity, ShouldEqual, SEVERITY_INFO)
+				So(p.Confirm, ShouldEqual, CONFIRM_NONE)
+				So(p.SecurityGroups, ShouldResemble, []string{SG_BASTION, SG_PUBLISHING_ELB, SG_WEB_ELB})
+				So(cfg.GetAnsibleDirectory(cfg.Environments[0]), ShouldEqual, "/src/dp-setup/ansible")
+			})
+		})
+
+		Convey("When a live, secure environment is resolved", func() {
+			p := cfg.GetPolicy("prod")
+
+			Convey("Then live should win the severity and drop the publishing SG", func() {
+				So(p.Severity, ShouldEqual, SEVERITY_ERROR)
+				So(p.NeedsPullDeclaration(), ShouldBeTrue)
+				So(p.IsDirectCopyAllowed(), ShouldBeFalse)
+				So(p.SecurityGroups, ShouldResemble, []string{SG_BASTION, SG_WEB_ELB})
+			})
+
+			Convey("Then live should need the environment name typed to confirm changes", func() {
+				So(p.Confirm, ShouldEqual, CONFIRM_TYPE_NAME)
+			})
+		})
+
+		Convey("When ci environments are resolved", func() {
+			ci, oldCI := cfg.GetPolicy("ci"), cfg.GetPolicy("old-ci")
+
+			Convey("Then they should use the dp-ci inventory and concourse SGs", func() {
+				So(ci.AWSEnvironmentTag, ShouldEqual, "ci")
+				So(ci.SecurityGroups, ShouldResemble, []string{SG_CONCOURSE_WEB, SG_CONCOURSE_WORKER})
+				So(cfg.GetPath(cfg.Environments[2]), ShouldEqual, "/src/dp-ci")
+				So(ci.IsPublicIP(), ShouldBeFalse)
+			})
+
+			Convey("Then only the awsa ci environment should use public IPs", func() {
+				So(oldCI.IsPublicIP(), ShouldBeTrue)
+				So(oldCI.IsSSHByIP(), ShouldBeTrue)
+			})
+		})
+
+		Convey("When a nisra environment is resolved", func() {
+			p := cfg.GetPolicy("nisra-prod")
+
+			Convey("Then it should use the nisra inventory and cantabular SG", func() {
+				So(cfg.GetPath(cfg.Environments[4]), ShouldEqual, "/src/dp-nisra")
+				So(p.SecurityGroups, ShouldResemble, []string{SG_CANTABULAR_UI_ELB})
+				So(p.Severity, ShouldEqual, SEVERITY_ERROR)
+			})
+		})
+
+		Convey("When the config defines a preset and an environment policy", func() {
+			cfg.PolicyPresets = map[string]Policy{
+				"data": {InventoryPath: "/src/dp-data", Severity: SEVERITY_WARN},
+			}
+			env := Environment{
+				Name:   "data-dev",
+				Tags:   []string{"data"},
+				Policy: &Policy{Severity: SEVERITY_INFO, SecurityGroups: []string{SG_BASTION}},
+			}
+			cfg.Environments = append(cfg.Environments, env)
+			cfg.resolvePolicies()
+			p := cfg.Environments[len(cfg.Environments)-1].GetPolicy()
+
+			Convey("Then the preset should apply, overridden by the environment policy", func() {
+				So(cfg.GetPath(env), ShouldEqual, "/src/dp-data")
+				So(p.Severity, ShouldEqual, SEVERITY_INFO)
+				So(p.SecurityGroups, ShouldResemble, []string{SG_BASTION})
+			})
+		})
+
+		Convey("When a live environment sets its own security groups", func() {
+			p := cfg.ResolvePolicy(Environment{Name: "prod4", Tags: []string{TAG_LIVE},
+				Policy: &Policy{SecurityGroups: []string{SG_BASTION, SG_PUBLISHING_ELB}}})
+
+			Convey("Then they should not be removed by the preset's excludes", func() {
+				So(p.SecurityGroups, ShouldResemble, []string{SG_BASTION, SG_PUBLISHING_ELB})
+			})
+
+			Convey("Then the environment's own excludes should still apply", func() {
+				p = cfg.ResolvePolicy(Environment{Name: "prod4", Tags: []string{TAG_LIVE},
+					Policy: &Policy{ExcludeSecurityGroups: []string{SG_WEB_ELB}}})
+				So(p.SecurityGroups, ShouldResemble, []string{SG_BASTION})
+			})
+		})
+
+		Convey("When a preset asks for a weaker confirmation than an earlier tag", func() {
+			cfg.PolicyPresets = map[string]Policy{"quick": {Confirm: CONFIRM_YES_NO}}
+			p := cfg.ResolvePolicy(Environment{Name: "prod2", Tags: []string{TAG_LIVE, "quick"}})
+
+			Convey("Then the stricter confirmation should be kept", func() {
+				So(p.Confirm, ShouldEqual, CONFIRM_TYPE_NAME)
+			})
+
+			Convey("Then the environment's own policy can still lower it", func() {
+				p = cfg.ResolvePolicy(Environment{Name: "prod2", Tags: []string{TAG_LIVE}, Policy: &Policy{Confirm: CONFIRM_NONE}})
+				So(p.Confirm, ShouldEqual, CONFIRM_NONE)
+			})
+		})
+
+		Convey("When the secure preset is layered with an environment's pull policy", func() {
+			cfg.PolicyPresets = map[string]Policy{"roomy": {PullMaxSize: "1GB"}}
+			p := cfg.ResolvePolicy(Environment{Name: "prod3", Tags: []string{TAG_SECURE, "roomy"},
+				Policy: &Policy{PullDenyPaths: []string{"/data/*"}}})
+
+			Convey("Then the deny-lists should be combined", func() {
+				So(p.PullDenyPaths, ShouldContain, "*.pem")
+				So(p.PullDenyPaths, ShouldContain, "/data/*")
+			})
+
+			Convey("Then a preset cannot raise the size limit", func() {
+				n, err := p.GetPullMaxBytes()
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 100<<20)
+			})
+		})
+	})
+}
+
+func TestValidate(t *testing.T) {
+	Convey("Given config files with policies", t, func() {
+		path := filepath.Join(t.TempDir(), "dp-cli-config.yml")
+		t.Setenv("DP_CLI_CONFIG", path)
+		load := func(yml string) (*Config, error) {
+			So(os.WriteFile(path, []byte(yml), 0600), ShouldBeNil)
+			return Get()
+		}
+
+		Convey("Then known values should load", func() {
+			cfg, err := load(`
+clean-confirm: yes-no
+policy-presets:
+  data:
+    ip-selection: public
+    ssh-target: ip
+    severity: warn
+    confirm: type-name
+    security-groups: [bastion, web-elb]
+environments:
+  - name: data-dev
+    tags: [data]
+    policy:
+      exclude-security-groups: [web-elb]
+`)
+			So(err, ShouldBeNil)
+			So(cfg.GetPolicy("data-dev").SecurityGroups, ShouldResemble, []string{SG_BASTION})
+		})
+
+		Convey("Then unknown values should be rejected", func() {
+			for yml, want := range map[string]string{
+				"environments: [{name: a, policy: {ip-selection: elastic}}]": `environment "a" policy: unknown ip-selection "elastic"`,
+				"environments: [{name: a, policy: {ssh-target: dns}}]":       `environment "a" policy: unknown ssh-target "dns"`,
+				"environments: [{name: a, policy: {severity: fatal}}]":       `environment "a" policy: unknown severity "fatal"`,
+				"environments: [{name: a, policy: {confirm: twice}}]":        `environment "a" policy: unknown confirm "twice"`,
+				"policy-presets: {data: {security-groups: [publishing]}}":    `policy-presets "data": unknown security group "publishing"`,
+				"policy-presets: {data: {exclude-security-groups: [web]}}":   `policy-presets "data": unknown security group "web"`,
+				"policy-presets: {data: {pull-max-size: lots}}":              `policy-presets "data": bad pull-max-size`,
+				"clean-confirm: always":                                      `clean-confirm: unknown confirm "always"`,
+			} {
+				_, err := load(yml)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, want)
+			}
+		})
+	})
+}
+
+func TestGetPullDenial(t *testing.T) {
+	Convey("Given a policy with a pull deny-list", t, func() {
+		p := Policy{PullDenyPaths: []string{"/var/lib/zebedee", "*.pem", "/data/*/raw/"}}
+
+		Convey("Then files below a denied dir should be denied", func() {
+			glob, isDenied := p.GetPullDenial("/var/lib/zebedee/collections/a.json")
+			So(isDenied, ShouldBeTrue)
+			So(glob, ShouldEqual, "/var/lib/zebedee")
+		})
+
+		Convey("Then a glob without a slash should match any name in the path", func() {
+			_, isDenied := p.GetPullDenial("/home/ubuntu/certs/server.pem")
+			So(isDenied, ShouldBeTrue)
+			_, isDenied = p.GetPullDenial("/etc/ssl/bundle.pem/part1")
+			So(isDenied, ShouldBeTrue)
+		})
+
+		Convey("Then globs should match dirs at their depth", func() {
+			_, isDenied := p.GetPullDenial("/data/cpih/raw/x.csv")
+			So(isDenied, ShouldBeTrue)
+			_, isDenied = p.GetPullDenial("/data/cpih/clean/x.csv")
+			So(isDenied, ShouldBeFalse)
+		})
+
+		Convey("Then other files should be allowed", func() {
+			_, isDenied := p.GetPullDenial("/var/log/app.log")
+			So(isDenied, ShouldBeFalse)
+			_, isDenied = p.GetPullDenial("/var/lib/zebedee2/a")
+			So(isDenied, ShouldBeFalse)
+		})
+	})
+}
+
+func TestParseSize(t *testing.T) {
+	Convey("Sizes should be parsed in powers of 1024", t, func() {
+		for size, expected := range map[string]int64{"512": 512, "10KB": 10 << 10, "100MB": 100 << 20, "1.5GB": 3 << 29, "2GiB": 2 << 30, "1t": 1 << 40} {
+			n, err := ParseSize(size)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, expected)
+		}
+		for _, size := range []string{"", "MB", "lots", "-1MB"} {
+			_, err := ParseSize(size)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SERVICES_FILE is the optional file, in an environment's ansible inventory dir, of its services
+const SERVICES_FILE = "dp-cli-services.yml"
+
+// Service is a named host and port on an environment, for port-forwarding (e.g. `-p dataset-api`)
+type Service struct {
+	Host      string `yaml:"host,omitempty"`       // default: localhost (i.e. the instance)
+	Port      int    `yaml:"port"`                 // remote port
+	LocalPort int    `yaml:"local-port,omitempty"` // default: Port
+	Group     string `yaml:"group,omitempty"`      // ansible group to forward via, for `dp curl`
+}
+
+// GetServices returns the services for the environment, from (in increasing precedence)
+// the config `services`, the inventory's SERVICES_FILE, and the env's `services`
+func (cfg Config) GetServices(env Environment) (map[string]Service, error) {
+	services := make(map[string]Service)
+	for name, svc := range cfg.Services {
+		services[name] = svc
+	}
+
+	path := filepath.Join(cfg.GetAnsibleDirectory(env), "inventories", env.Name, SERVICES_FILE)
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("cannot read %q: %w", path, err)
+	}
+	if err == nil {
+		var inventoryServices map[string]Service
+		if err = yaml.Unmarshal(b, &inventoryServices); err != nil {
+			return nil, fmt.Errorf("cannot parse %q: %w", path, err)
+		}
+		for name, svc := range inventoryServices {
+			services[name] = svc
+		}
+	}
+
+	for name, svc := range env.Services {
+		services[name] = svc
+	}
+	return services, nil
+}
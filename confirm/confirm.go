@@ -0,0 +1,56 @@
+package confirm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/out"
+	"golang.org/x/term"
+)
+
+// Environment asks for confirmation (per the env's policy) before `action` is done to the environment.
+// It returns an error (so the action should not be done) unless confirmed, or `isYes` (i.e. `--yes`) was given
+func Environment(env config.Environment, action string, isYes bool) error {
+	return Ask(env.GetPolicy().Confirm, env.Name, action, isYes)
+}
+
+// Ask asks for confirmation, using `mode` (one of config.CONFIRM_*), before `action` is done to `name`
+func Ask(mode, name, action string, isYes bool) error {
+	if isYes && mode != config.CONFIRM_NONE && mode != "" {
+		out.WarnFHighlight("confirmed by --yes: %s on %s", action, name)
+	}
+	return ask(os.Stdin, os.Stdout, term.IsTerminal(int(os.Stdin.Fd())), mode, name, action, isYes)
+}
+
+func ask(in io.Reader, w io.Writer, isTTY bool, mode, name, action string, isYes bool) error {
+	if mode == config.CONFIRM_NONE || mode == "" || isYes {
+		return nil
+	}
+	if !isTTY {
+		// nobody to ask, so refuse rather than assume
+		return fmt.Errorf("not confirmed: %s on %s needs confirmation, but stdin is not a terminal (use --yes)", action, name)
+	}
+
+	reader := bufio.NewReader(in)
+	switch mode {
+	case config.CONFIRM_YES_NO:
+		fmt.Fprintf(w, "%s on %s? [y/N]: ", action, name)
+		answer, _ := reader.ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer == "y" || answer == "yes" {
+			return nil
+		}
+	case config.CONFIRM_TYPE_NAME:
+		fmt.Fprintf(w, "%s on %s?\nType the environment name (%s) to confirm: ", action, name, name)
+		answer, _ := reader.ReadString('\n')
+		if strings.TrimSpace(answer) == name {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown confirm %q in policy for %s (use %s, %s or %s)", mode, name, config.CONFIRM_NONE, config.CONFIRM_YES_NO, config.CONFIRM_TYPE_NAME)
+	}
+	return fmt.Errorf("not confirmed: %s on %s", action, name)
+}
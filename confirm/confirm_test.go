@@ -0,0 +1,66 @@
+package confirm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-cli/config"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAsk(t *testing.T) {
+	Convey("Given an action needs confirming on prod", t, func() {
+		var w bytes.Buffer
+		askWith := func(input string, isTTY bool, mode string, isYes bool) error {
+			return ask(strings.NewReader(input), &w, isTTY, mode, "prod", "deny access", isYes)
+		}
+
+		Convey("When the policy needs no confirmation", func() {
+			Convey("Then nothing should be asked", func() {
+				So(askWith("", false, config.CONFIRM_NONE, false), ShouldBeNil)
+				So(w.String(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the policy needs yes/no", func() {
+			Convey("Then yes should confirm", func() {
+				So(askWith("y\n", true, config.CONFIRM_YES_NO, false), ShouldBeNil)
+				So(w.String(), ShouldContainSubstring, "deny access on prod? [y/N]")
+			})
+
+			Convey("Then anything else should refuse", func() {
+				So(askWith("\n", true, config.CONFIRM_YES_NO, false), ShouldNotBeNil)
+				So(askWith("", true, config.CONFIRM_YES_NO, false), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the policy needs the environment name typed", func() {
+			Convey("Then only the exact name should confirm", func() {
+				So(askWith("prod\n", true, config.CONFIRM_TYPE_NAME, false), ShouldBeNil)
+				So(askWith("y\n", true, config.CONFIRM_TYPE_NAME, false), ShouldNotBeNil)
+				So(askWith("Prod\n", true, config.CONFIRM_TYPE_NAME, false), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When stdin is not a terminal", func() {
+			err := askWith("prod\n", false, config.CONFIRM_TYPE_NAME, false)
+
+			Convey("Then it should refuse (without asking)", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "--yes")
+				So(w.String(), ShouldBeEmpty)
+			})
+
+			Convey("Then --yes should confirm", func() {
+				So(askWith("", false, config.CONFIRM_TYPE_NAME, true), ShouldBeNil)
+			})
+		})
+
+		Convey("When the policy has an unknown confirmation", func() {
+			Convey("Then it should refuse", func() {
+				So(askWith("y\n", true, "maybe", false), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,203 @@
+package curl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/confirm"
+	"github.com/ONSdigital/dp-cli/ssh"
+)
+
+// forwardTimeout is how long to wait for the port-forward to be ready
+const forwardTimeout = 30 * time.Second
+
+// authHeader is a header set from an environment variable (when set), to authenticate with services
+type authHeader struct {
+	EnvVar string
+	Header string
+	Prefix string
+}
+
+var authHeaders = []authHeader{
+	{EnvVar: "SERVICE_AUTH_TOKEN", Header: "Authorization", Prefix: "Bearer "},
+	{EnvVar: "FLORENCE_TOKEN", Header: "X-Florence-Token"},
+}
+
+// Options holds the state of flags given
+type Options struct {
+	Method             *string
+	Data               *string
+	Headers            *[]string
+	IsIncludingHeaders *bool
+	IsRaw              *bool
+	IsNoAuth           *bool
+	Group              *string
+	InstanceNum        *int
+	Timeout            *time.Duration
+	AssumeYes          *bool
+}
+
+// Run makes the request to `path` on the service (via a port-forward to an instance of its group) and writes the response
+func Run(cfg *config.Config, env config.Environment, service, path string, opts Options) error {
+	services, err := cfg.GetServices(env)
+	if err != nil {
+		return err
+	}
+	svc, ok := services[service]
+	if !ok {
+		return fmt.Errorf("no service %q for %s (see `services` in config)", service, env.Name)
+	}
+	group := *opts.Group
+	if group == "" {
+		group = svc.Group
+	}
+	if group == "" {
+		return fmt.Errorf("no group to forward to %s via (use `--group`, or `group` for the service in config)", service)
+	}
+
+	method := getMethod(opts)
+	if method != http.MethodGet && method != http.MethodHead {
+		if err = confirm.Environment(env, fmt.Sprintf("%s %s on %s", method, path, service), *opts.AssumeYes); err != nil {
+			return err
+		}
+	}
+
+	instances, err := aws.ListEC2ByAnsibleGroup(env.Name, cfg.GetProfile(env.Name), group, cfg)
+	if err != nil {
+		return err
+	}
+	if *opts.InstanceNum < 1 || *opts.InstanceNum > len(instances) {
+		return fmt.Errorf("no instance %d in %s %s (there are %d)", *opts.InstanceNum, env.Name, group, len(instances))
+	}
+
+	fwd, err := ssh.StartForward(cfg, env, instances[*opts.InstanceNum-1], service, forwardTimeout)
+	if err != nil {
+		return err
+	}
+	defer fwd.Close()
+
+	return Do(fmt.Sprintf("http://localhost:%d", fwd.LocalPort), path, opts, os.Stdout)
+}
+
+func getMethod(opts Options) string {
+	if *opts.Method != "" {
+		return strings.ToUpper(*opts.Method)
+	}
+	if *opts.Data != "" {
+		return http.MethodPost
+	}
+	return http.MethodGet
+}
+
+// Do makes the request to `path` on `baseURL` and writes the response (JSON pretty-printed) to `w`.
+// It returns an error for an HTTP error status (after writing the response)
+func Do(baseURL, path string, opts Options, w io.Writer) error {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	body, err := getBody(*opts.Data)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(getMethod(opts), baseURL+path, body)
+	if err != nil {
+		return err
+	}
+
+	if !*opts.IsNoAuth {
+		for _, auth := range authHeaders {
+			if token := os.Getenv(auth.EnvVar); token != "" {
+				req.Header.Set(auth.Header, auth.Prefix+token)
+			}
+		}
+	}
+	for _, header := range *opts.Headers {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok {
+			return fmt.Errorf("bad header %q (use `Name: value`)", header)
+		}
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{Timeout: *opts.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if *opts.IsIncludingHeaders {
+		writeHeaders(w, resp)
+	}
+	if !*opts.IsRaw && json.Valid(respBody) {
+		var pretty bytes.Buffer
+		if err = json.Indent(&pretty, respBody, "", "  "); err == nil {
+			respBody = pretty.Bytes()
+		}
+	}
+	if len(respBody) > 0 {
+		w.Write(respBody)
+		if respBody[len(respBody)-1] != '\n' {
+			fmt.Fprintln(w)
+		}
+	}
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s %s: %s", req.Method, path, resp.Status)
+	}
+	return nil
+}
+
+// getBody returns the request body for `data` - which may be `@<file>` (or `@-` for stdin)
+func getBody(data string) (io.Reader, error) {
+	if data == "" {
+		return nil, nil
+	}
+	file, isFile := strings.CutPrefix(data, "@")
+	if !isFile {
+		return strings.NewReader(data), nil
+	}
+	var b []byte
+	var err error
+	if file == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read request body: %w", err)
+	}
+	return bytes.NewReader(b), nil
+}
+
+func writeHeaders(w io.Writer, resp *http.Response) {
+	fmt.Fprintf(w, "%s %s\n", resp.Proto, resp.Status)
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range resp.Header[name] {
+			fmt.Fprintf(w, "%s: %s\n", name, value)
+		}
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,97 @@
+package curl
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newOptions() Options {
+	method, data := "", ""
+	var headers []string
+	include, raw, noAuth := false, false, false
+	group, instance, timeout, yes := "", 1, 5*time.Second, false
+	return Options{
+		Method: &method, Data: &data, Headers: &headers,
+		IsIncludingHeaders: &include, IsRaw: &raw, IsNoAuth: &noAuth,
+		Group: &group, InstanceNum: &instance, Timeout: &timeout, AssumeYes: &yes,
+	}
+}
+
+func TestDo(t *testing.T) {
+	Convey("Given a service which echoes requests as JSON", t, func() {
+		var gotReq *http.Request
+		var gotBody string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotReq = r
+			b, _ := io.ReadAll(r.Body)
+			gotBody = string(b)
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Path == "/missing" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+			w.Write([]byte(`{"path":"` + r.URL.Path + `","ok":true}`))
+		}))
+		defer srv.Close()
+		opts := newOptions()
+		var buf bytes.Buffer
+
+		Convey("When a GET is made with a service auth token in the environment", func() {
+			t.Setenv("SERVICE_AUTH_TOKEN", "s3cret")
+			err := Do(srv.URL, "datasets", opts, &buf)
+
+			Convey("Then the response should be pretty-printed", func() {
+				So(err, ShouldBeNil)
+				So(buf.String(), ShouldEqual, "{\n  \"path\": \"/datasets\",\n  \"ok\": true\n}\n")
+			})
+
+			Convey("Then the auth header should be sent", func() {
+				So(gotReq.Method, ShouldEqual, http.MethodGet)
+				So(gotReq.Header.Get("Authorization"), ShouldEqual, "Bearer s3cret")
+			})
+		})
+
+		Convey("When data is given, with --no-auth and --raw", func() {
+			t.Setenv("SERVICE_AUTH_TOKEN", "s3cret")
+			*opts.Data = `{"a":1}`
+			*opts.IsNoAuth = true
+			*opts.IsRaw = true
+			*opts.Headers = []string{"X-Test: yes"}
+			err := Do(srv.URL, "/datasets", opts, &buf)
+
+			Convey("Then it should be POSTed without auth, and the response shown as received", func() {
+				So(err, ShouldBeNil)
+				So(gotReq.Method, ShouldEqual, http.MethodPost)
+				So(gotBody, ShouldEqual, `{"a":1}`)
+				So(gotReq.Header.Get("Authorization"), ShouldBeEmpty)
+				So(gotReq.Header.Get("X-Test"), ShouldEqual, "yes")
+				So(buf.String(), ShouldEqual, `{"path":"/datasets","ok":true}`+"\n")
+			})
+		})
+
+		Convey("When the response is an error status", func() {
+			*opts.IsIncludingHeaders = true
+			err := Do(srv.URL, "/missing", opts, &buf)
+
+			Convey("Then the response should be shown, and an error returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "404")
+				So(buf.String(), ShouldStartWith, "HTTP/1.1 404 Not Found\n")
+				So(buf.String(), ShouldContainSubstring, "Content-Type: application/json\n")
+			})
+		})
+
+		Convey("When a header is malformed", func() {
+			*opts.Headers = []string{"no-colon"}
+
+			Convey("Then there should be an error", func() {
+				So(Do(srv.URL, "/", opts, &buf), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,246 @@
+package doctor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/out"
+)
+
+// Status is the outcome of a Check
+type Status string
+
+const (
+	PASS Status = "pass"
+	WARN Status = "warn"
+	FAIL Status = "fail"
+)
+
+// Result is the outcome of a Check, with a remedy when it did not pass
+type Result struct {
+	Check   string `json:"check"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	Remedy  string `json:"remedy,omitempty"`
+}
+
+// Options holds the state of flags given
+type Options struct {
+	IsFetching *bool
+	IsOffline  *bool
+	IsJSON     *bool
+}
+
+// expectedBranches are the branches each inventory repo should be on (see README)
+var expectedBranches = map[string][]string{
+	config.INVENTORY_DP_SETUP: {"awsb", "main"},
+	config.INVENTORY_DP_CI:    {"main"},
+	config.INVENTORY_NISRA:    {"develop"},
+}
+
+// Run runs all the checks and reports them, returning an error if any failed
+func Run(cfg *config.Config, opts Options) error {
+	results := CheckTools()
+	results = append(results, CheckRepos(cfg, *opts.IsFetching)...)
+	if !*opts.IsOffline {
+		results = append(results, CheckAWS(cfg)...)
+	}
+
+	if *opts.IsJSON {
+		if err := writeJSON(os.Stdout, results); err != nil {
+			return err
+		}
+	} else {
+		report(results)
+	}
+
+	countFails := 0
+	for _, r := range results {
+		if r.Status == FAIL {
+			countFails++
+		}
+	}
+	if countFails > 0 {
+		return fmt.Errorf("%d doctor check(s) failed", countFails)
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+func report(results []Result) {
+	for _, r := range results {
+		switch r.Status {
+		case PASS:
+			out.Highlight(out.INFO, "[pass] %s: %s", r.Check, r.Message)
+		case WARN:
+			out.Highlight(out.WARN, "[warn] %s: %s", r.Check, r.Message)
+		default:
+			out.Highlight(out.ERROR, "[fail] %s: %s", r.Check, r.Message)
+		}
+		if r.Remedy != "" {
+			fmt.Printf("       remedy: %s\n", r.Remedy)
+		}
+	}
+}
+
+// CheckTools checks that the programs dp-cli runs are on the PATH
+func CheckTools() (results []Result) {
+	remedies := map[string]string{
+		"ssh":                    "install OpenSSH",
+		"scp":                    "install OpenSSH",
+		"rsync":                  "install rsync: `brew install rsync`",
+		"aws":                    "install the AWS CLI: `brew install awscli`",
+		"session-manager-plugin": "`brew install --cask session-manager-plugin`",
+		"git":                    "install git",
+	}
+	for _, tool := range Tools {
+		info := tool.Inspect()
+		name := "tool " + tool.Name
+		switch {
+		case info.Path == "":
+			status := FAIL
+			if tool.Name == "git" || tool.Name == "rsync" {
+				status = WARN // only needed for the repo checks, or `dp sync`
+			}
+			results = append(results, Result{Check: name, Status: status, Message: "not found on PATH", Remedy: remedies[tool.Name]})
+		case info.Err != nil:
+			results = append(results, Result{Check: name, Status: WARN, Message: fmt.Sprintf("%s: cannot get version: %s", info.Path, info.Err)})
+		default:
+			results = append(results, Result{Check: name, Status: PASS, Message: strings.TrimSpace(info.Path + " " + info.Version)})
+		}
+	}
+	return
+}
+
+// CheckRepos checks that the inventory repos used by the environments exist, are on the expected branch and up to date
+func CheckRepos(cfg *config.Config, isFetching bool) (results []Result) {
+	seen := make(map[string]bool)
+	for _, env := range cfg.Environments {
+		path := cfg.GetPath(env)
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		policy := env.GetPolicy()
+		name := "repo " + policy.Inventory
+		if policy.InventoryPath != "" {
+			name = "repo " + path
+		}
+		results = append(results, checkRepo(name, path, expectedBranches[policy.Inventory], isFetching, env.Name))
+	}
+	return
+}
+
+func checkRepo(name, path string, branches []string, isFetching bool, envName string) Result {
+	if path == "" {
+		return Result{Check: name, Status: FAIL, Message: "path not set in config (needed by " + envName + ")", Remedy: "clone the repo and set its path in " + config.GetConfigPath()}
+	}
+	if _, err := os.Stat(path); err != nil {
+		return Result{Check: name, Status: FAIL, Message: path + " does not exist", Remedy: "clone the repo or fix its path in " + config.GetConfigPath()}
+	}
+
+	branch, err := git(path, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return Result{Check: name, Status: WARN, Message: fmt.Sprintf("%s: cannot determine branch: %s", path, err)}
+	}
+	if len(branches) > 0 && !contains(branches, branch) {
+		return Result{Check: name, Status: FAIL, Message: fmt.Sprintf("%s is on branch %q", path, branch), Remedy: fmt.Sprintf("`git -C %s checkout %s`", path, branches[0])}
+	}
+
+	if isFetching {
+		if _, err = git(path, "fetch", "--quiet"); err != nil {
+			return Result{Check: name, Status: WARN, Message: fmt.Sprintf("%s: cannot fetch: %s", path, err)}
+		}
+	}
+	behind, err := git(path, "rev-list", "--count", "HEAD..@{upstream}")
+	if err != nil {
+		return Result{Check: name, Status: WARN, Message: fmt.Sprintf("%s (%s) has no upstream branch", path, branch)}
+	}
+	if n, _ := strconv.Atoi(behind); n > 0 {
+		return Result{Check: name, Status: WARN, Message: fmt.Sprintf("%s (%s) is %d commit(s) behind", path, branch, n), Remedy: fmt.Sprintf("`git -C %s pull`", path)}
+	}
+	msg := fmt.Sprintf("%s (%s) is up to date", path, branch)
+	if !isFetching {
+		msg += " (as of last fetch, use --fetch to check remote)"
+	}
+	return Result{Check: name, Status: PASS, Message: msg}
+}
+
+func git(path string, args ...string) (string, error) {
+	b, err := exec.Command("git", append([]string{"-C", path}, args...)...).Output()
+	return strings.TrimSpace(string(b)), err
+}
+
+// CheckAWS checks the AWS env vars, that each environment's profile resolves and that the SGs allow your IP
+func CheckAWS(cfg *config.Config) (results []Result) {
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if v := os.Getenv(name); v != "" {
+			results = append(results, Result{Check: "env " + name, Status: WARN, Message: "set to " + v + " (can hide environments)", Remedy: "`unset " + name + "`"})
+		}
+	}
+
+	myIP, ipErr := cfg.GetMyIP()
+	if ipErr != nil {
+		results = append(results, Result{Check: "my ip", Status: WARN, Message: ipErr.Error(), Remedy: "use `MY_IP` or `ip-address` in config"})
+	}
+	hasUser := cfg.UserName != nil && len(*cfg.UserName) > 0
+
+	for _, env := range cfg.Environments {
+		profile := cfg.GetProfile(env.Name)
+		name := "aws " + env.Name
+		if err := aws.CheckProfile(profile); err != nil {
+			results = append(results, Result{Check: name, Status: FAIL, Message: fmt.Sprintf("profile %q: %s", profile, err), Remedy: profileRemedy(err, profile)})
+			continue
+		}
+		results = append(results, Result{Check: name, Status: PASS, Message: fmt.Sprintf("profile %q resolves", profile)})
+
+		if ipErr != nil || !hasUser {
+			continue
+		}
+		name = "access " + env.Name
+		missing, err := aws.GetMissingAccessForEnvironment(cfg.UserName, env.Name, profile, env.ExtraPorts, myIP, cfg)
+		if err != nil {
+			results = append(results, Result{Check: name, Status: WARN, Message: err.Error(), Remedy: "ensure you have `region=eu-west-2` in your AWS config"})
+			continue
+		}
+		if len(missing) > 0 {
+			results = append(results, Result{Check: name, Status: WARN, Message: fmt.Sprintf("%s not allowed for ports %v", myIP, missing), Remedy: "`dp remote allow " + env.Name + "`"})
+			continue
+		}
+		results = append(results, Result{Check: name, Status: PASS, Message: myIP + " is allowed"})
+	}
+	return
+}
+
+func profileRemedy(err error, profile string) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "MissingRegion"):
+		return "add `region = eu-west-2` to [profile " + profile + "] in ~/.aws/config"
+	case strings.Contains(msg, "SSO"), strings.Contains(msg, "expired"):
+		return "`dp remote login` (or `aws sso login --profile " + profile + "`)"
+	}
+	return "check [profile " + profile + "] in ~/.aws/config (see README for a sample)"
+}
+
+func contains(list []string, s string) bool {
+	for _, each := range list {
+		if each == s {
+			return true
+		}
+	}
+	return false
+}
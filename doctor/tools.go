@@ -0,0 +1,50 @@
+package doctor
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// Tool is an external program that dp-cli runs
+type Tool struct {
+	Name        string
+	VersionArgs []string // nil when the tool cannot report its version
+}
+
+// Tools are the programs that dp-cli shells out to
+var Tools = []Tool{
+	{Name: "ssh", VersionArgs: []string{"-V"}},
+	{Name: "scp"},
+	{Name: "rsync", VersionArgs: []string{"--version"}},
+	{Name: "aws", VersionArgs: []string{"--version"}},
+	{Name: "session-manager-plugin", VersionArgs: []string{"--version"}},
+	{Name: "git", VersionArgs: []string{"--version"}},
+}
+
+// ToolInfo is the result of looking for a Tool
+type ToolInfo struct {
+	Name    string `json:"name"`
+	Path    string `json:"path,omitempty"`
+	Version string `json:"version,omitempty"`
+	Err     error  `json:"-"`
+}
+
+// Inspect finds the tool on the PATH and obtains its version
+func (t Tool) Inspect() ToolInfo {
+	info := ToolInfo{Name: t.Name}
+	if info.Path, info.Err = exec.LookPath(t.Name); info.Err != nil {
+		return info
+	}
+	if t.VersionArgs == nil {
+		return info
+	}
+
+	// some tools (e.g. ssh) report their version on stderr
+	b, err := exec.Command(info.Path, t.VersionArgs...).CombinedOutput()
+	if err != nil {
+		info.Err = err
+		return info
+	}
+	info.Version, _, _ = strings.Cut(strings.TrimSpace(string(b)), "\n")
+	return info
+}
@@ -0,0 +1,21 @@
+package logs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Fmt writes the lines from `in` to `w`, formatted (and filtered) by `f`
+func Fmt(in io.Reader, w io.Writer, f *Formatter) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if text, ok := f.Format(scanner.Text()); ok {
+			if _, err := fmt.Fprintln(w, text); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,229 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/fatih/color"
+)
+
+// TIME_FORMAT is how times are shown in formatted log lines
+const TIME_FORMAT = "2006-01-02T15:04:05.000Z07:00"
+
+var severityNames = map[int]string{
+	int(log.FATAL): "FATAL",
+	int(log.ERROR): "ERROR",
+	int(log.WARN):  "WARN",
+	int(log.INFO):  "INFO",
+}
+
+var severityColours = map[int]*color.Color{
+	int(log.FATAL): color.New(color.Bold, color.FgHiRed),
+	int(log.ERROR): color.New(color.FgHiRed),
+	int(log.WARN):  color.New(color.FgHiYellow),
+	int(log.INFO):  color.New(color.FgHiBlue),
+}
+
+// ParseEvent returns the structured (log.go) event in `line`, if it is one
+func ParseEvent(line string) (ev log.EventData, ok bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return ev, false
+	}
+	if err := json.Unmarshal([]byte(line), &ev); err != nil || ev.Event == "" {
+		return ev, false
+	}
+	return ev, true
+}
+
+// GetSeverity returns the event's severity (INFO, if not set)
+func GetSeverity(ev log.EventData) int {
+	if ev.Severity == nil {
+		return int(log.INFO)
+	}
+	return int(*ev.Severity)
+}
+
+// ParseSeverity returns the severity named (e.g. "warn") or numbered (e.g. "2") by `s`
+func ParseSeverity(s string) (int, error) {
+	for severity, name := range severityNames {
+		if strings.EqualFold(s, name) || s == fmt.Sprint(severity) {
+			return severity, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q (use fatal, error, warn or info)", s)
+}
+
+// Formatter pretty-prints structured (log.go) events, aligning their namespaces
+// and filtering them by severity and namespace
+type Formatter struct {
+	MaxSeverity int      // the least severe (highest) severity shown, e.g. log.WARN shows FATAL, ERROR and WARN
+	Namespaces  []string // only show these namespaces (globs, e.g. "dp-*-api"), if set
+	Fields      []string // only show these data fields, if set
+	nsWidth     int
+}
+
+// NewFormatter returns a Formatter which shows all events and fields
+func NewFormatter() *Formatter {
+	return &Formatter{MaxSeverity: int(log.INFO)}
+}
+
+// isFiltering is true when some events may not be shown
+func (f *Formatter) isFiltering() bool {
+	return f.MaxSeverity < int(log.INFO) || len(f.Namespaces) > 0
+}
+
+// Format returns `line` pretty-printed if it is (or ends with) a structured event, else unchanged.
+// It returns false if the line should not be shown - plain lines are not shown when filtering
+func (f *Formatter) Format(line string) (string, bool) {
+	prefix, ev, ok := "", log.EventData{}, false
+	if i := strings.Index(line, "{"); i >= 0 {
+		prefix = line[:i]
+		ev, ok = ParseEvent(line[i:])
+	}
+	if !ok {
+		return line, !f.isFiltering()
+	}
+	if GetSeverity(ev) > f.MaxSeverity || !f.isNamespaceShown(ev.Namespace) {
+		return "", false
+	}
+	return prefix + f.FormatEvent(ev), true
+}
+
+func (f *Formatter) isNamespaceShown(namespace string) bool {
+	if len(f.Namespaces) == 0 {
+		return true
+	}
+	for _, pattern := range f.Namespaces {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatLine returns `line` pretty-printed, if it is a structured (log.go) event, else unchanged
+func FormatLine(line string) string {
+	s, _ := NewFormatter().Format(line)
+	return s
+}
+
+// FormatEvent returns a one-line summary of the event, then a line for each error
+func FormatEvent(ev log.EventData) string {
+	return NewFormatter().FormatEvent(ev)
+}
+
+// FormatEvent returns a one-line summary of the event (with its namespace aligned to those before it),
+// then a line for each error
+func (f *Formatter) FormatEvent(ev log.EventData) string {
+	severity := GetSeverity(ev)
+	name, ok := severityNames[severity]
+	if !ok {
+		name = fmt.Sprint(severity)
+	}
+	c, ok := severityColours[severity]
+	if !ok {
+		c = severityColours[int(log.INFO)]
+	}
+
+	var b strings.Builder
+	if !ev.CreatedAt.IsZero() {
+		b.WriteString(ev.CreatedAt.Format(TIME_FORMAT) + " ")
+	}
+	b.WriteString(c.Sprintf("%-5s", name) + " ")
+	if ev.Namespace != "" {
+		if len(ev.Namespace) > f.nsWidth {
+			f.nsWidth = len(ev.Namespace)
+		}
+		b.WriteString(fmt.Sprintf("%-*s ", f.nsWidth+1, ev.Namespace+":"))
+	}
+	b.WriteString(c.Sprint(ev.Event))
+
+	if ev.HTTP != nil {
+		b.WriteString(" " + formatHTTP(ev.HTTP))
+	}
+	if ev.Data != nil {
+		for _, kv := range formatFields(f.selectFields(*ev.Data)) {
+			b.WriteString(" " + kv)
+		}
+	}
+	if ev.TraceID != "" {
+		b.WriteString(" trace_id=" + ev.TraceID)
+	}
+	if ev.Errors != nil {
+		for _, e := range *ev.Errors {
+			b.WriteString("\n    " + c.Sprint("error: ") + e.Message)
+			if data, ok := e.Data.(map[string]interface{}); ok {
+				for _, kv := range formatFields(data) {
+					b.WriteString(" " + kv)
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+func formatHTTP(h *log.EventHTTP) string {
+	words := []string{h.Method, h.Path}
+	if h.Query != "" {
+		words[1] += "?" + h.Query
+	}
+	if h.StatusCode != nil {
+		words = append(words, fmt.Sprint(*h.StatusCode))
+	}
+	if h.Duration != nil {
+		words = append(words, h.Duration.Round(time.Microsecond).String())
+	}
+	return "[" + strings.TrimSpace(strings.Join(words, " ")) + "]"
+}
+
+// selectFields returns the data fields to show
+func (f *Formatter) selectFields(data map[string]interface{}) map[string]interface{} {
+	if len(f.Fields) == 0 {
+		return data
+	}
+	selected := make(map[string]interface{})
+	for _, k := range f.Fields {
+		if v, ok := data[k]; ok {
+			selected[k] = v
+		}
+	}
+	return selected
+}
+
+// formatFields returns the fields as `key=value`, sorted by key
+func formatFields(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, k+"="+formatValue(fields[k]))
+	}
+	return kvs
+}
+
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		if strings.ContainsAny(val, " \t\"=") || val == "" {
+			return fmt.Sprintf("%q", val)
+		}
+		return val
+	case nil:
+		return "null"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
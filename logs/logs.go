@@ -0,0 +1,156 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/out"
+	"github.com/ONSdigital/dp-cli/ssh"
+	"github.com/fatih/color"
+)
+
+// followWindow is how long lines are held, when following, to be merged in time order
+const followWindow = time.Second
+
+// hostColours are cycled through for the instances' line prefixes
+var hostColours = []*color.Color{
+	color.New(color.FgCyan),
+	color.New(color.FgMagenta),
+	color.New(color.FgGreen),
+	color.New(color.FgYellow),
+	color.New(color.FgBlue),
+	color.New(color.FgHiCyan),
+	color.New(color.FgHiMagenta),
+	color.New(color.FgHiGreen),
+}
+
+// allocSuffix is the nomad allocation id at the end of a container name
+var allocSuffix = regexp.MustCompile(`-[0-9a-f]{8}(-[0-9a-f]{4}){3}-[0-9a-f]{12}$`)
+
+// Options holds the state of flags given
+type Options struct {
+	Service *string
+	Since   *string
+	Follow  *bool
+	Grep    *string
+}
+
+// getRemoteCommand returns the remote shell command which writes `<container> <timestamp> <line>`
+// for the logs of each (matching) container on an instance
+func getRemoteCommand(opts Options) string {
+	ps := "sudo docker ps --format '{{.Names}}'"
+	if *opts.Service != "" {
+		ps += " --filter name=" + ssh.ShellQuote(*opts.Service)
+	}
+	logsArgs := "--timestamps"
+	if *opts.Follow {
+		logsArgs += " --follow"
+	}
+	if *opts.Since != "" {
+		logsArgs += " --since " + ssh.ShellQuote(*opts.Since)
+	}
+	return fmt.Sprintf(`for c in $(%s); do sudo docker logs %s "$c" 2>&1 | sed -u "s/^/$c /" & done; wait`, ps, logsArgs)
+}
+
+// Run shows the (merged) logs of the containers on the `instances` of the group
+func Run(cfg *config.Config, env config.Environment, grp string, instances []aws.EC2Result, opts Options) error {
+	var grep *regexp.Regexp
+	if *opts.Grep != "" {
+		var err error
+		if grep, err = regexp.Compile(*opts.Grep); err != nil {
+			return fmt.Errorf("bad `--grep` pattern: %w", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	remoteCmd := getRemoteCommand(opts)
+	lines := make(chan Line, 1024)
+	hosts := make([]string, len(instances))
+	var wg sync.WaitGroup
+	var errsMu sync.Mutex
+	var errs []string
+
+	for i, instance := range instances {
+		hosts[i] = fmt.Sprintf("%s %d", grp, i+1)
+		c, err := ssh.RemoteCommand(cfg, env, instance, remoteCmd)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func(i int, c *exec.Cmd) {
+			defer wg.Done()
+			if err := stream(ctx, c, i, lines); err != nil && ctx.Err() == nil {
+				errsMu.Lock()
+				errs = append(errs, fmt.Sprintf("%s: %s", hosts[i], err))
+				errsMu.Unlock()
+			}
+		}(i, c)
+	}
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	out.Highlight(out.GetLevel(env), "showing logs for %s %s (%s instances)", env.Name, grp, len(instances))
+	window := time.Duration(-1)
+	if *opts.Follow {
+		window = followWindow
+	}
+	formatter := NewFormatter()
+	Merge(lines, window, func(l Line) {
+		if grep != nil && !grep.MatchString(l.Text) {
+			return
+		}
+		prefix := hostColours[l.Source%len(hostColours)].Sprintf("[%s %s]", hosts[l.Source], l.Prefix)
+		text, _ := formatter.Format(l.Text)
+		if _, ok := ParseEvent(l.Text); !ok {
+			text = l.Time.Format(TIME_FORMAT) + " " + text
+		}
+		fmt.Println(prefix, text)
+	})
+
+	if len(errs) > 0 {
+		return fmt.Errorf("could not get logs from: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// stream sends the lines from the command's output to `lines` until it exits or `ctx` is done
+func stream(ctx context.Context, c *exec.Cmd, source int, lines chan<- Line) error {
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	c.Stderr = os.Stderr
+	if err = c.Start(); err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		if c.Process != nil {
+			c.Process.Kill()
+		}
+	}()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		container, rest, _ := strings.Cut(scanner.Text(), " ")
+		t, text := ParseTimestamped(rest, time.Now())
+		lines <- Line{Source: source, Prefix: allocSuffix.ReplaceAllString(container, ""), Time: t, Text: text}
+	}
+	return c.Wait()
+}
@@ -0,0 +1,162 @@
+package logs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFormatLine(t *testing.T) {
+	color.NoColor = true
+
+	Convey("Given log lines need formatting", t, func() {
+
+		Convey("When the line is a log.go event", func() {
+			line := `{"created_at":"2024-01-02T13:04:05.123Z","namespace":"dp-dataset-api","event":"request received","severity":3,` +
+				`"http":{"method":"GET","path":"/datasets","status_code":200},"data":{"id":"cpih01","count":2},"trace_id":"abc"}`
+
+			Convey("Then it should be pretty-printed", func() {
+				So(FormatLine(line), ShouldEqual, `2024-01-02T13:04:05.123Z INFO  dp-dataset-api: request received [GET /datasets 200] count=2 id=cpih01 trace_id=abc`)
+			})
+		})
+
+		Convey("When the event has errors", func() {
+			line := `{"created_at":"2024-01-02T13:04:05.123Z","namespace":"dp-x","event":"failed","severity":1,"errors":[{"message":"boom","data":{"a":"b c"}}]}`
+
+			Convey("Then each error should be on its own line", func() {
+				So(FormatLine(line), ShouldEqual, "2024-01-02T13:04:05.123Z ERROR dp-x: failed\n    error: boom a=\"b c\"")
+			})
+		})
+
+		Convey("When the line is not a log.go event", func() {
+			Convey("Then it should be unchanged", func() {
+				So(FormatLine("plain text"), ShouldEqual, "plain text")
+				So(FormatLine(`{"not":"an event"}`), ShouldEqual, `{"not":"an event"}`)
+			})
+		})
+	})
+}
+
+func TestParseTimestamped(t *testing.T) {
+	Convey("Given docker log lines with timestamps", t, func() {
+		now := time.Now()
+
+		Convey("When the line has a timestamp", func() {
+			ts, text := ParseTimestamped("2024-01-02T13:04:05.123456789Z hello world", now)
+
+			Convey("Then the time and text should be split", func() {
+				So(ts.Equal(time.Date(2024, 1, 2, 13, 4, 5, 123456789, time.UTC)), ShouldBeTrue)
+				So(text, ShouldEqual, "hello world")
+			})
+		})
+
+		Convey("When the line has no timestamp", func() {
+			ts, text := ParseTimestamped("hello world", now)
+
+			Convey("Then it should be given the time now", func() {
+				So(ts, ShouldEqual, now)
+				So(text, ShouldEqual, "hello world")
+			})
+		})
+	})
+}
+
+func TestMerge(t *testing.T) {
+	Convey("Given lines arrive from several sources out of order", t, func() {
+		base := time.Date(2024, 1, 2, 13, 0, 0, 0, time.UTC)
+		in := make(chan Line, 10)
+		in <- Line{Source: 0, Time: base.Add(2 * time.Second), Text: "c"}
+		in <- Line{Source: 1, Time: base, Text: "a"}
+		in <- Line{Source: 0, Time: base.Add(3 * time.Second), Text: "d"}
+		in <- Line{Source: 1, Time: base.Add(time.Second), Text: "b"}
+		close(in)
+
+		for _, window := range []time.Duration{-1, 50 * time.Millisecond} {
+			Convey("When merged with window "+window.String(), func() {
+				var texts []string
+				Merge(in, window, func(l Line) { texts = append(texts, l.Text) })
+
+				Convey("Then they should be emitted in time order", func() {
+					So(texts, ShouldResemble, []string{"a", "b", "c", "d"})
+				})
+			})
+		}
+	})
+}
+
+func TestGetRemoteCommand(t *testing.T) {
+	Convey("Given logs are wanted for a service", t, func() {
+		service, since, follow, grep := "dp-dataset-api", "10m", true, ""
+		cmd := getRemoteCommand(Options{Service: &service, Since: &since, Follow: &follow, Grep: &grep})
+
+		Convey("Then the remote command should follow the matching containers' logs", func() {
+			So(cmd, ShouldContainSubstring, "--filter name=dp-dataset-api")
+			So(cmd, ShouldContainSubstring, "docker logs --timestamps --follow --since 10m")
+		})
+	})
+}
+
+func TestFmt(t *testing.T) {
+	color.NoColor = true
+
+	Convey("Given JSON log lines from several services", t, func() {
+		input := strings.Join([]string{
+			`{"namespace":"dp-dataset-api","event":"started","severity":3,"data":{"port":22000,"version":"1.2"}}`,
+			`not json`,
+			`{"namespace":"dp-frontend-router","event":"slow","severity":2,"data":{"path":"/x"}}`,
+			`router | {"namespace":"dp-frontend-router","event":"failed","severity":1,"trace_id":"t1"}`,
+		}, "\n")
+
+		Convey("When formatted without filters", func() {
+			var buf bytes.Buffer
+			So(Fmt(strings.NewReader(input), &buf, NewFormatter()), ShouldBeNil)
+
+			Convey("Then all lines should be shown, with namespaces aligned", func() {
+				So(buf.String(), ShouldEqual, strings.Join([]string{
+					`INFO  dp-dataset-api: started port=22000 version=1.2`,
+					`not json`,
+					`WARN  dp-frontend-router: slow path=/x`,
+					`router | ERROR dp-frontend-router: failed trace_id=t1`,
+				}, "\n")+"\n")
+			})
+		})
+
+		Convey("When filtered by severity", func() {
+			var buf bytes.Buffer
+			f := NewFormatter()
+			f.MaxSeverity, _ = ParseSeverity("warn")
+			So(Fmt(strings.NewReader(input), &buf, f), ShouldBeNil)
+
+			Convey("Then only warnings and worse should be shown (without plain lines)", func() {
+				So(buf.String(), ShouldNotContainSubstring, "started")
+				So(buf.String(), ShouldNotContainSubstring, "not json")
+				So(buf.String(), ShouldContainSubstring, "slow")
+				So(buf.String(), ShouldContainSubstring, "failed")
+			})
+		})
+
+		Convey("When filtered by namespace and fields", func() {
+			var buf bytes.Buffer
+			f := NewFormatter()
+			f.Namespaces = []string{"dp-*-api"}
+			f.Fields = []string{"version"}
+			So(Fmt(strings.NewReader(input), &buf, f), ShouldBeNil)
+
+			Convey("Then only the matching events should be shown, with the chosen fields", func() {
+				So(buf.String(), ShouldEqual, "INFO  dp-dataset-api: started version=1.2\n")
+			})
+		})
+
+		Convey("When an unknown severity is given", func() {
+			_, err := ParseSeverity("loud")
+
+			Convey("Then there should be an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,80 @@
+package logs
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Line is a log line from a source (instance and container)
+type Line struct {
+	Source int       // index of the source (e.g. instance) it came from
+	Prefix string    // e.g. the container name
+	Time   time.Time // from the line's timestamp, else when it was read
+	Text   string
+}
+
+// ParseTimestamped splits a `docker logs --timestamps` line into its time and text.
+// Lines without a timestamp are given `now`
+func ParseTimestamped(line string, now time.Time) (time.Time, string) {
+	ts, text, found := strings.Cut(line, " ")
+	if found {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			return t, text
+		}
+	}
+	return now, line
+}
+
+// Merge reads lines from `in` and calls `emit` for them in time order, until `in` is closed.
+// Lines are held for up to `window` (to be ordered among lines from other sources which arrive later),
+// or if `window` is negative, until `in` is closed
+func Merge(in <-chan Line, window time.Duration, emit func(Line)) {
+	type held struct {
+		line    Line
+		arrived time.Time
+	}
+	var pending []held
+
+	flush := func(all bool) {
+		if len(pending) == 0 {
+			return
+		}
+		sort.SliceStable(pending, func(i, j int) bool { return pending[i].line.Time.Before(pending[j].line.Time) })
+		cutoff := time.Now().Add(-window)
+		// emit (in time order) the lines up to the last one that has been held long enough
+		n := 0
+		if all {
+			n = len(pending)
+		} else {
+			for i, h := range pending {
+				if !h.arrived.After(cutoff) {
+					n = i + 1
+				}
+			}
+		}
+		for _, h := range pending[:n] {
+			emit(h.line)
+		}
+		pending = pending[n:]
+	}
+
+	var tick <-chan time.Time
+	if window >= 0 {
+		ticker := time.NewTicker(window/4 + time.Millisecond)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case line, ok := <-in:
+			if !ok {
+				flush(true)
+				return
+			}
+			pending = append(pending, held{line: line, arrived: time.Now()})
+		case <-tick:
+			flush(false)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package out
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/ONSdigital/dp-cli/config"
 	"github.com/fatih/color"
@@ -36,24 +37,44 @@ func getColor(lvl Level) *color.Color {
 	}
 }
 
+// GetLevel returns the output level for the `severity` in the env's policy
 func GetLevel(env config.Environment) Level {
-	if env.IsLive() {
+	return getLevelForSeverity(env.GetPolicy().Severity)
+}
+
+func getLevelForSeverity(severity string) Level {
+	switch severity {
+	case config.SEVERITY_ERROR:
 		return ERROR
-	}
-	if env.IsSecure() {
+	case config.SEVERITY_WARN:
 		return WARN
+	default:
+		return INFO
 	}
-	return INFO
 }
 
 func Write(lvl Level, msg string) {
 	getColor(lvl).Printf("%s ", outPrefix)
-	fmt.Printf("%s\n", msg)
+	fmt.Fprintf(color.Output, "%s\n", msg)
 }
 
 func WriteF(lvl Level, msg string, args ...interface{}) {
 	getColor(lvl).Printf("%s ", outPrefix)
-	fmt.Printf(msg, args...)
+	fmt.Fprintf(color.Output, msg, args...)
+}
+
+// Writer returns where the output goes (stdout, unless UseStderr)
+func Writer() io.Writer {
+	return color.Output
+}
+
+// UseStderr sends the output to stderr (e.g. while stdout is a file being streamed), until the returned func is called
+func UseStderr() (restore func()) {
+	stdout := color.Output
+	color.Output = color.Error
+	return func() {
+		color.Output = stdout
+	}
 }
 
 func Highlight(lvl Level, msg string, args ...interface{}) {
@@ -77,12 +98,12 @@ func cliPrefix(c *color.Color) {
 
 func Info(msg string) {
 	cliPrefix(infoBoldC)
-	fmt.Printf("%s\n", msg)
+	fmt.Fprintf(color.Output, "%s\n", msg)
 }
 
 func Warn(msg string) {
 	cliPrefix(warningBoldC)
-	fmt.Printf("%s\n", msg)
+	fmt.Fprintf(color.Output, "%s\n", msg)
 }
 
 func InfoAppend(msg string) {
@@ -91,12 +112,12 @@ func InfoAppend(msg string) {
 
 func InfoF(msg string, args ...interface{}) {
 	cliPrefix(infoBoldC)
-	fmt.Printf(msg, args...)
+	fmt.Fprintf(color.Output, msg, args...)
 }
 
 func Error(err error) {
 	cliPrefix(errorBoldC)
-	fmt.Printf("%s\n", err.Error())
+	fmt.Fprintf(color.Output, "%s\n", err.Error())
 }
 
 func InfoFHighlight(msg string, args ...interface{}) {
@@ -130,5 +151,5 @@ func highlightTrail(c *color.Color, formattedMsg, endOfLine string, args ...inte
 	}
 
 	formattedMsg = fmt.Sprintf(formattedMsg, highlighted...)
-	fmt.Printf("%s%s", formattedMsg, endOfLine)
+	fmt.Fprintf(color.Output, "%s%s", formattedMsg, endOfLine)
 }
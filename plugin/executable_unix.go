@@ -0,0 +1,17 @@
+//go:build !windows
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// getExecutableName returns the name the file at `path` is run by, if it is executable
+func getExecutableName(path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return "", false
+	}
+	return filepath.Base(path), true
+}
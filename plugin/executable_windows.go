@@ -0,0 +1,22 @@
+//go:build windows
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// getExecutableName returns the name the file at `path` is run by (without its extension), if it is executable.
+// Windows has no exec bits, so executables are the files with an extension in PATHEXT
+func getExecutableName(path string) (string, bool) {
+	name, ok := trimPathExt(filepath.Base(path), os.Getenv("PATHEXT"))
+	if !ok {
+		return "", false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return name, true
+}
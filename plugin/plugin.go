@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ONSdigital/dp-cli/config"
+)
+
+// PREFIX is the start of the name of a plugin executable, e.g. `dp-foo` is run by `dp foo`
+const PREFIX = "dp-"
+
+// env vars given to plugins
+const (
+	ENV_CONFIG      = "DP_CLI_CONFIG"      // path of the config file
+	ENV_CONFIG_JSON = "DP_CLI_CONFIG_JSON" // the resolved config (redacted) as JSON
+	ENV_ENV         = "DP_CLI_ENV"         // the selected environment name (first arg, if an environment)
+	ENV_ENV_JSON    = "DP_CLI_ENV_JSON"    // the selected environment (with resolved policy) as JSON
+	ENV_PROFILE     = "DP_CLI_ENV_PROFILE" // the AWS profile for the selected environment
+	ENV_ANSIBLE     = "DP_CLI_ENV_ANSIBLE" // the ansible dir for the selected environment
+)
+
+// Plugin is an external `dp-<name>` executable
+type Plugin struct {
+	Name string
+	Path string
+}
+
+// Discover returns the plugins in `plugins-dir` (first) then on the PATH, skipping any `reserved` names
+// and any later executables with the same name (as the PATH does)
+func Discover(cfg *config.Config, reserved map[string]bool) []Plugin {
+	dirs := filepath.SplitList(os.Getenv("PATH"))
+	if cfg.PluginsDir != "" {
+		dirs = append([]string{cfg.PluginsDir}, dirs...)
+	}
+
+	seen := make(map[string]bool)
+	var plugins []Plugin
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), PREFIX) {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			fileName, ok := getExecutableName(path)
+			if !ok {
+				continue
+			}
+			name := strings.TrimPrefix(fileName, PREFIX)
+			if name == "" || seen[name] || reserved[name] {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, Plugin{Name: name, Path: path})
+		}
+	}
+
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+// trimPathExt returns the file name without its extension, if the extension is one of the (`;` separated,
+// case-insensitive) executable extensions of Windows' `pathext` (e.g. `dp-foo.exe` is run as `dp-foo`)
+func trimPathExt(fileName, pathext string) (string, bool) {
+	if pathext == "" {
+		pathext = ".com;.exe;.bat;.cmd" // the default, as os/exec uses
+	}
+	ext := filepath.Ext(fileName)
+	if ext == "" {
+		return "", false
+	}
+	for _, e := range strings.Split(pathext, ";") {
+		if strings.EqualFold(ext, e) {
+			return strings.TrimSuffix(fileName, ext), true
+		}
+	}
+	return "", false
+}
+
+// Command returns the command to run the plugin with `args`, passing the config
+// (and the environment, when the first arg names one) in env vars
+func (p Plugin) Command(cfg *config.Config, args []string) (*exec.Cmd, error) {
+	c := exec.Command(p.Path, args...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	cfgJSON, err := cfg.RedactedJSON()
+	if err != nil {
+		return nil, err
+	}
+	c.Env = append(os.Environ(),
+		ENV_CONFIG+"="+config.GetConfigPath(),
+		ENV_CONFIG_JSON+"="+string(cfgJSON),
+	)
+
+	if len(args) > 0 {
+		if env, ok := cfg.GetEnvironment(args[0]); ok {
+			envJSON, err := config.RedactedEnvironmentJSON(env)
+			if err != nil {
+				return nil, err
+			}
+			c.Env = append(c.Env,
+				ENV_ENV+"="+env.Name,
+				ENV_ENV_JSON+"="+string(envJSON),
+				ENV_PROFILE+"="+cfg.GetProfile(env.Name),
+				ENV_ANSIBLE+"="+cfg.GetAnsibleDirectory(env),
+			)
+		}
+	}
+	return c, nil
+}
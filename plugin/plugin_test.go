@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/ONSdigital/dp-cli/config"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTrimPathExt(t *testing.T) {
+	Convey("Windows executables should be run by their name without the extension", t, func() {
+		name, ok := trimPathExt("dp-foo.EXE", ".COM;.EXE;.BAT")
+		So(ok, ShouldBeTrue)
+		So(name, ShouldEqual, "dp-foo")
+
+		name, ok = trimPathExt("dp-foo.cmd", "")
+		So(ok, ShouldBeTrue)
+		So(name, ShouldEqual, "dp-foo")
+
+		_, ok = trimPathExt("dp-foo.txt", ".COM;.EXE;.BAT;.CMD")
+		So(ok, ShouldBeFalse)
+		_, ok = trimPathExt("dp-foo", ".COM;.EXE;.BAT;.CMD")
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestDiscover(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are found by their exec bits")
+	}
+	Convey("Given executables in the plugins dir and on the PATH", t, func() {
+		pluginsDir, bin := t.TempDir(), t.TempDir()
+		So(os.WriteFile(filepath.Join(pluginsDir, "dp-foo"), nil, 0755), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(pluginsDir, "dp-notes"), nil, 0644), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(bin, "dp-foo"), nil, 0755), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(bin, "dp-ssh"), nil, 0755), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(bin, "dp-bar"), nil, 0755), ShouldBeNil)
+		t.Setenv("PATH", bin)
+
+		Convey("When the plugins are discovered", func() {
+			plugins := Discover(&config.Config{PluginsDir: pluginsDir}, map[string]bool{"ssh": true})
+
+			Convey("Then only the executables not shadowed (or reserved) should be found", func() {
+				So(plugins, ShouldResemble, []Plugin{
+					{Name: "bar", Path: filepath.Join(bin, "dp-bar")},
+					{Name: "foo", Path: filepath.Join(pluginsDir, "dp-foo")},
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,272 @@
+package remotefs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/ssh"
+)
+
+// entry types
+const (
+	TYPE_FILE    = "file"
+	TYPE_DIR     = "dir"
+	TYPE_SYMLINK = "symlink"
+	TYPE_OTHER   = "other"
+)
+
+// TIME_FORMAT is how modification times are shown in long listings
+const TIME_FORMAT = "2006-01-02 15:04"
+
+// findFormat is the `find -printf` format of an Entry: NUL-separated fields (so any name can be parsed)
+const findFormat = `%y\0%s\0%M\0%m\0%u\0%g\0%T@\0%p\0%l\0`
+
+// countFields is the number of fields in findFormat
+const countFields = 9
+
+// Entry is a remote file, dir or other file-system entry
+type Entry struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Type       string    `json:"type"` // one of TYPE_*
+	Size       int64     `json:"size"`
+	Mode       string    `json:"mode"` // e.g. -rw-r--r--
+	Perm       string    `json:"perm"` // octal, e.g. 644
+	Owner      string    `json:"owner"`
+	Group      string    `json:"group"`
+	ModTime    time.Time `json:"mod_time"`
+	LinkTarget string    `json:"link_target,omitempty"`
+}
+
+// FindOptions filter the entries found by Find
+type FindOptions struct {
+	Name     string // glob of names
+	Type     string // one of TYPE_FILE, TYPE_DIR or TYPE_SYMLINK
+	MaxDepth int    // 0 for no limit
+}
+
+// findPath returns `p` quoted for the remote shell, so that find does not take it as an option
+func findPath(p string) string {
+	if strings.HasPrefix(p, "-") {
+		p = "./" + p
+	}
+	return ssh.ShellQuote(p)
+}
+
+// parseEntries parses the output of `find -printf findFormat`
+func parseEntries(output []byte) ([]Entry, error) {
+	fields := strings.Split(string(output), "\x00")
+	if len(fields) > 0 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields)%countFields != 0 {
+		return nil, fmt.Errorf("unexpected remote listing (%d fields)", len(fields))
+	}
+	entries := make([]Entry, 0, len(fields)/countFields)
+	for i := 0; i < len(fields); i += countFields {
+		f := fields[i : i+countFields]
+		size, err := strconv.ParseInt(f[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected size in remote listing: %q", f[1])
+		}
+		secs, err := strconv.ParseFloat(f[6], 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected time in remote listing: %q", f[6])
+		}
+		entries = append(entries, Entry{
+			Name:       path.Base(f[7]),
+			Path:       f[7],
+			Type:       getType(f[0]),
+			Size:       size,
+			Mode:       f[2],
+			Perm:       f[3],
+			Owner:      f[4],
+			Group:      f[5],
+			ModTime:    time.Unix(0, int64(secs*float64(time.Second))),
+			LinkTarget: f[8],
+		})
+	}
+	return entries, nil
+}
+
+// getType returns the entry type for a `find %y` type
+func getType(y string) string {
+	switch y {
+	case "f":
+		return TYPE_FILE
+	case "d":
+		return TYPE_DIR
+	case "l":
+		return TYPE_SYMLINK
+	}
+	return TYPE_OTHER
+}
+
+// run runs the (remote) shell command on the instance, returning its output
+func run(cfg *config.Config, env config.Environment, instance aws.EC2Result, remoteCmd string) ([]byte, error) {
+	c, err := ssh.RemoteCommand(cfg, env, instance, remoteCmd)
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	output, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return output, nil
+}
+
+// find runs `find` on the instance with the `args` (after the path), returning the entries found
+func find(cfg *config.Config, env config.Environment, instance aws.EC2Result, opt, p string, args ...string) ([]Entry, error) {
+	remoteCmd := strings.TrimSpace("find "+opt+" "+findPath(p)+" "+strings.Join(args, " ")) + " -printf '" + findFormat + "'"
+	output, err := run(cfg, env, instance, remoteCmd)
+	if err != nil {
+		return nil, err
+	}
+	return parseEntries(output)
+}
+
+// List returns the entries in the remote dir `p` (sorted by name), or the entry itself if not a dir.
+// Hidden entries (names starting with `.`) are only returned when `isAll`
+func List(cfg *config.Config, env config.Environment, instance aws.EC2Result, p string, isAll bool) ([]Entry, error) {
+	// -H follows `p` if it is a symlink (e.g. to a dir), as `ls` does
+	entries, err := find(cfg, env, instance, "-H", p, "-maxdepth", "1")
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 || entries[0].Type != TYPE_DIR {
+		return entries, nil
+	}
+	var children []Entry
+	for _, e := range entries[1:] {
+		if isAll || !strings.HasPrefix(e.Name, ".") {
+			children = append(children, e)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	return children, nil
+}
+
+// Stat returns the remote entry `p` (a symlink itself, not its target)
+func Stat(cfg *config.Config, env config.Environment, instance aws.EC2Result, p string) (Entry, error) {
+	entries, err := find(cfg, env, instance, "", p, "-maxdepth", "0")
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(entries) != 1 {
+		return Entry{}, fmt.Errorf("no such file: %s", p)
+	}
+	return entries[0], nil
+}
+
+// getFindArgs returns the `find` expression for the options
+func getFindArgs(opts FindOptions) ([]string, error) {
+	var args []string
+	if opts.MaxDepth > 0 {
+		args = append(args, "-maxdepth", strconv.Itoa(opts.MaxDepth))
+	}
+	switch opts.Type {
+	case "":
+	case TYPE_FILE, "f":
+		args = append(args, "-type", "f")
+	case TYPE_DIR, "d":
+		args = append(args, "-type", "d")
+	case TYPE_SYMLINK, "l":
+		args = append(args, "-type", "l")
+	default:
+		return nil, fmt.Errorf("unknown type %q (use %s, %s or %s)", opts.Type, TYPE_FILE, TYPE_DIR, TYPE_SYMLINK)
+	}
+	if opts.Name != "" {
+		args = append(args, "-name", ssh.ShellQuote(opts.Name))
+	}
+	return args, nil
+}
+
+// Find returns the entries below the remote dir `p` which match the options
+func Find(cfg *config.Config, env config.Environment, instance aws.EC2Result, p string, opts FindOptions) ([]Entry, error) {
+	args, err := getFindArgs(opts)
+	if err != nil {
+		return nil, err
+	}
+	return find(cfg, env, instance, "-H", p, args...)
+}
+
+// Cat writes the contents of the remote file `p` to `w`
+func Cat(cfg *config.Config, env config.Environment, instance aws.EC2Result, p string, w io.Writer) error {
+	c, err := ssh.RemoteCommand(cfg, env, instance, "cat -- "+ssh.ShellQuote(p))
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	c.Stdout, c.Stderr = w, &stderr
+	if err = c.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// Complete returns the remote paths (for shell completion) which start with `toComplete`. Dirs end with `/`
+func Complete(cfg *config.Config, env config.Environment, instance aws.EC2Result, toComplete string) []string {
+	dir, prefix := ".", toComplete
+	if i := strings.LastIndex(toComplete, "/"); i >= 0 {
+		dir, prefix = toComplete[:i+1], toComplete[i+1:]
+	}
+	entries, err := List(cfg, env, instance, dir, strings.HasPrefix(prefix, "."))
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name, prefix) {
+			continue
+		}
+		p := e.Name
+		if dir != "." {
+			p = dir + e.Name
+		}
+		if e.Type == TYPE_DIR {
+			p += "/"
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// FormatLong returns the entry as a line of a long listing (like `ls -l`)
+func FormatLong(e Entry, name string) string {
+	if e.LinkTarget != "" {
+		name += " -> " + e.LinkTarget
+	}
+	return fmt.Sprintf("%s %-8s %-8s %10d %s %s", e.Mode, e.Owner, e.Group, e.Size, e.ModTime.Local().Format(TIME_FORMAT), name)
+}
+
+// FormatShort returns the entry's name, with `/` after a dir
+func FormatShort(e Entry, name string) string {
+	if e.Type == TYPE_DIR {
+		return name + "/"
+	}
+	return name
+}
+
+// WriteJSON writes `v` (e.g. entries) to `w` as indented JSON
+func WriteJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,131 @@
+package remotefs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/ssh/sshtest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseEntries(t *testing.T) {
+	Convey("Given a listing with an awkward name", t, func() {
+		output := "f\x0012\x00-rw-r--r--\x00644\x00ubuntu\x00ubuntu\x001700000000.5\x00/tmp/a\tb\nc\x00\x00" +
+			"l\x007\x00lrwxrwxrwx\x00777\x00root\x00root\x001700000000\x00/tmp/link\x00/tmp/a\x00"
+
+		Convey("When it is parsed", func() {
+			entries, err := parseEntries([]byte(output))
+
+			Convey("Then each entry should have its fields", func() {
+				So(err, ShouldBeNil)
+				So(entries, ShouldHaveLength, 2)
+				So(entries[0].Name, ShouldEqual, "a\tb\nc")
+				So(entries[0].Type, ShouldEqual, TYPE_FILE)
+				So(entries[0].Size, ShouldEqual, 12)
+				So(entries[0].ModTime.UnixMilli(), ShouldEqual, 1700000000500)
+				So(entries[1].Type, ShouldEqual, TYPE_SYMLINK)
+				So(entries[1].LinkTarget, ShouldEqual, "/tmp/a")
+			})
+		})
+
+		Convey("When it is truncated, then it should fail", func() {
+			_, err := parseEntries([]byte(output[:20]))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestGetFindArgs(t *testing.T) {
+	Convey("The find options should become a find expression", t, func() {
+		args, err := getFindArgs(FindOptions{Name: "*.log", Type: TYPE_FILE, MaxDepth: 2})
+		So(err, ShouldBeNil)
+		So(args, ShouldResemble, []string{"-maxdepth", "2", "-type", "f", "-name", "'*.log'"})
+
+		_, err = getFindArgs(FindOptions{Type: "socket"})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestRemoteFS(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the remote commands need GNU find")
+	}
+	Convey("Given an instance whose files are local", t, func() {
+		remote := t.TempDir()
+		cfg := sshtest.UseFakeSSH(t)
+
+		So(os.MkdirAll(filepath.Join(remote, "logs", "old"), 0755), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(remote, "logs", "app.log"), []byte("hello\n"), 0644), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(remote, "logs", "old", "app.1.log"), []byte("old\n"), 0644), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(remote, ".profile"), nil, 0644), ShouldBeNil)
+		So(os.Symlink(filepath.Join(remote, "logs"), filepath.Join(remote, "current")), ShouldBeNil)
+
+		env := config.Environment{Name: "sandbox"}
+		instance := aws.EC2Result{InstanceId: "i-1"}
+
+		Convey("When a dir is listed, then its entries should be sorted, without hidden ones", func() {
+			entries, err := List(cfg, env, instance, remote, false)
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 2)
+			So(entries[0].Name, ShouldEqual, "current")
+			So(entries[0].Type, ShouldEqual, TYPE_SYMLINK)
+			So(entries[1].Name, ShouldEqual, "logs")
+			So(FormatShort(entries[1], entries[1].Name), ShouldEqual, "logs/")
+
+			entries, err = List(cfg, env, instance, remote, true)
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 3)
+		})
+
+		Convey("When a symlink to a dir is listed, then the dir should be listed", func() {
+			entries, err := List(cfg, env, instance, filepath.Join(remote, "current"), false)
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 2)
+			So(entries[0].Name, ShouldEqual, "app.log")
+		})
+
+		Convey("When a file is listed or stat-ed, then it should be returned", func() {
+			entries, err := List(cfg, env, instance, filepath.Join(remote, "logs", "app.log"), false)
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 1)
+			So(entries[0].Size, ShouldEqual, 6)
+			So(entries[0].Perm, ShouldEqual, "644")
+
+			e, err := Stat(cfg, env, instance, filepath.Join(remote, "current"))
+			So(err, ShouldBeNil)
+			So(e.Type, ShouldEqual, TYPE_SYMLINK)
+			So(e.LinkTarget, ShouldEqual, filepath.Join(remote, "logs"))
+		})
+
+		Convey("When a missing path is listed, then it should fail", func() {
+			_, err := List(cfg, env, instance, filepath.Join(remote, "nope"), false)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When files are found by name, then their paths should be returned", func() {
+			entries, err := Find(cfg, env, instance, remote, FindOptions{Name: "*.log", Type: TYPE_FILE})
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 2)
+			for _, e := range entries {
+				So(e.Path, ShouldStartWith, filepath.Join(remote, "logs"))
+			}
+		})
+
+		Convey("When a file is cat-ed, then its contents should be written", func() {
+			var buf bytes.Buffer
+			So(Cat(cfg, env, instance, filepath.Join(remote, "logs", "app.log"), &buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "hello\n")
+		})
+
+		Convey("When a path is completed, then the matching entries should be returned", func() {
+			So(Complete(cfg, env, instance, filepath.Join(remote, "lo")), ShouldResemble, []string{filepath.Join(remote, "logs") + "/"})
+			So(Complete(cfg, env, instance, filepath.Join(remote, "logs")+"/a"), ShouldResemble, []string{filepath.Join(remote, "logs", "app.log")})
+			So(Complete(cfg, env, instance, remote+"/."), ShouldResemble, []string{remote + "/.profile"})
+		})
+	})
+}
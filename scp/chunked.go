@@ -0,0 +1,437 @@
+package scp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/out"
+	"github.com/ONSdigital/dp-cli/ssh"
+)
+
+// DEFAULT_CHUNK_SIZE is the size of the chunks of a resumable transfer
+const DEFAULT_CHUNK_SIZE = "8MB"
+
+// suffixes of the (temporary) files next to the target of a resumable transfer
+const (
+	stagingSuffix  = ".dp-part" // dir of chunks
+	assemblySuffix = ".dp-tmp"  // the file, before it is verified
+)
+
+// Manifest records a resumable (chunked) transfer of a file, so that an interrupted transfer can be resumed.
+// Chunks are sent (or fetched) into a staging dir next to the target, then joined and verified
+type Manifest struct {
+	Environment string    `json:"environment"`
+	InstanceID  string    `json:"instance_id"`
+	IsPull      bool      `json:"is_pull"`
+	Source      string    `json:"source"`
+	Target      string    `json:"target"`
+	RemotePath  string    `json:"remote_path"` // resolved remote file (target of a push, source of a pull)
+	Size        int64     `json:"size"`
+	ModTime     int64     `json:"mod_time"` // of the source (unix seconds)
+	Mode        uint32    `json:"mode"`     // permissions of the source
+	ChunkSize   int64     `json:"chunk_size"`
+	SHA256      string    `json:"sha256"` // of the whole file
+	Chunks      []string  `json:"chunks"` // SHA-256 of each chunk
+	Started     time.Time `json:"started"`
+}
+
+// getManifestPath returns the manifest file for a transfer (so that running the same `dp scp` again finds it)
+func getManifestPath(cfg *config.Config, env config.Environment, instance aws.EC2Result, isPull bool, source, target string) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%t\x00%s\x00%s", env.Name, instance.InstanceId, isPull, source, target)))
+	return filepath.Join(cfg.GetTransfersDir(), hex.EncodeToString(h[:8])+".json")
+}
+
+func loadManifest(manifestPath string) (*Manifest, error) {
+	b, err := os.ReadFile(manifestPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	m := &Manifest{}
+	if err = json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("bad manifest %s: %w", manifestPath, err)
+	}
+	return m, nil
+}
+
+func (m *Manifest) save(manifestPath string) error {
+	if err := os.MkdirAll(filepath.Dir(manifestPath), 0700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath, b, 0600)
+}
+
+// chunkLen returns the length of chunk `i`
+func (m *Manifest) chunkLen(i int) int64 {
+	return min(m.ChunkSize, m.Size-int64(i)*m.ChunkSize)
+}
+
+// chunkName is the name of chunk `i` in the staging dir
+func chunkName(i int) string {
+	return fmt.Sprintf("%06d", i)
+}
+
+// countChunks returns the number of chunks of a file (an empty file has none)
+func countChunks(size, chunkSize int64) int {
+	return int((size + chunkSize - 1) / chunkSize)
+}
+
+// getSums returns the SHA-256 checksum of all of `r`, and of each `chunkSize` chunk of it
+func getSums(r io.Reader, chunkSize int64) (sum string, chunks []string, err error) {
+	whole := sha256.New()
+	for {
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(whole, h), io.LimitReader(r, chunkSize))
+		if err != nil {
+			return "", nil, err
+		}
+		if n == 0 {
+			break
+		}
+		chunks = append(chunks, hex.EncodeToString(h.Sum(nil)))
+		if n < chunkSize {
+			break
+		}
+	}
+	return hex.EncodeToString(whole.Sum(nil)), chunks, nil
+}
+
+// transfer runs remote commands for a resumable transfer, reusing one ssh connection
+type transfer struct {
+	cfg      *config.Config
+	env      config.Environment
+	instance aws.EC2Result
+	sshOpts  []string
+}
+
+func newTransfer(cfg *config.Config, env config.Environment, instance aws.EC2Result) *transfer {
+	t := &transfer{cfg: cfg, env: env, instance: instance}
+	// later commands reuse the connection of the first, rather than connecting (via SSM or the bastion) for every chunk
+	if dir, err := cfg.GetRuntimeDir("ssh"); err == nil {
+		t.sshOpts = []string{"-o", "ControlMaster=auto", "-o", "ControlPath=" + filepath.Join(dir, "cm-%C"), "-o", "ControlPersist=60"}
+	}
+	return t
+}
+
+// run runs the (remote) shell `script` with `stdin` (if not nil), writing its output to `stdout`
+func (t *transfer) run(script string, stdin io.Reader, stdout io.Writer) error {
+	c, err := ssh.RemoteCommandWithOptions(t.cfg, t.env, t.instance, t.sshOpts, script)
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	c.Stdin, c.Stdout, c.Stderr = stdin, stdout, &stderr
+	// the backgrounded ssh master must not hold up the command
+	c.WaitDelay = 5 * time.Second
+	if err = c.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// output runs the (remote) shell `script`, returning its output lines
+func (t *transfer) output(script string) ([]string, error) {
+	var stdout bytes.Buffer
+	if err := t.run(script, nil, &stdout); err != nil {
+		return nil, err
+	}
+	var lines []string
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// chunkProgress shows progress through the chunks on `w`
+type chunkProgress struct {
+	w       io.Writer
+	started time.Time
+	total   int
+	bytes   int64
+}
+
+func (p *chunkProgress) done(i int, n int64, verb string) {
+	p.bytes += n
+	fmt.Fprintf(p.w, "\rchunk %d/%d %s, %s", i+1, p.total, verb, formatProgress(p.bytes, time.Since(p.started)))
+}
+
+// getResumableError explains that an interrupted transfer can be resumed
+func getResumableError(err error) error {
+	return fmt.Errorf("transfer interrupted (run the same command with `--resume` to continue): %w", err)
+}
+
+// pushChunked pushes `localFile` to `target` on the instance in chunks, which can be resumed (`isResume`)
+// if the push is interrupted. Chunks already on the instance (matching the manifest) are not sent again
+func pushChunked(cfg *config.Config, env config.Environment, instance aws.EC2Result, localFile, target string, chunkSize int64, isResume bool, progress io.Writer) error {
+	f, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a file (resumable transfers are for single files)", localFile)
+	}
+
+	manifestPath := getManifestPath(cfg, env, instance, false, localFile, target)
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	isResuming := isResume && m != nil && m.Size == info.Size() && m.ModTime == info.ModTime().Unix()
+	if isResume && !isResuming {
+		out.WarnFHighlight("no resumable push of %s (or it has changed), so starting from the beginning", localFile)
+	}
+	if !isResuming {
+		m = &Manifest{Environment: env.Name, InstanceID: instance.InstanceId, Source: localFile, Target: target,
+			Size: info.Size(), ModTime: info.ModTime().Unix(), Mode: uint32(info.Mode().Perm()), ChunkSize: chunkSize, Started: time.Now().UTC()}
+		if m.SHA256, m.Chunks, err = getSums(f, chunkSize); err != nil {
+			return err
+		}
+	}
+
+	t := newTransfer(cfg, env, instance)
+	// resolve the target (a dir gets the file's name, and it is made absolute), check its dir exists (as scp would),
+	// then list the chunks already sent
+	prepare := "t=" + ssh.ShellQuote(target) + `; [ -d "$t" ] && t="${t%/}"/` + ssh.ShellQuote(filepath.Base(localFile)) + `; case "$t" in /*) ;; *) t="$PWD/$t" ;; esac; ` +
+		`[ -d "$(dirname -- "$t")" ] || { echo "no such directory: $(dirname -- "$t")" >&2; exit 1; }; `
+	if !isResuming {
+		prepare += `rm -rf -- "$t` + stagingSuffix + `"; `
+	}
+	prepare += `mkdir -p -- "$t` + stagingSuffix + `" && echo "$t" && cd -- "$t` + stagingSuffix + `" && for c in *; do [ -f "$c" ] && sha256sum -- "$c"; done; true`
+	lines, err := t.output(prepare)
+	if err != nil {
+		return fmt.Errorf("cannot prepare the push on the instance: %w", err)
+	}
+	if len(lines) == 0 {
+		return fmt.Errorf("cannot prepare the push on the instance: no target path for %s", target)
+	}
+	m.RemotePath = lines[0]
+	sent := parseChunkSums(lines[1:])
+	if err = m.save(manifestPath); err != nil {
+		return err
+	}
+
+	stage := ssh.ShellQuote(m.RemotePath + stagingSuffix)
+	p := &chunkProgress{w: progress, started: time.Now(), total: len(m.Chunks)}
+	for i, sum := range m.Chunks {
+		name := chunkName(i)
+		if sent[name] == sum {
+			continue
+		}
+		chunk := io.NewSectionReader(f, int64(i)*m.ChunkSize, m.chunkLen(i))
+		if err = t.run("cat > "+stage+"/"+name+".tmp && mv -f "+stage+"/"+name+".tmp "+stage+"/"+name, chunk, nil); err != nil {
+			fmt.Fprintln(progress)
+			return getResumableError(err)
+		}
+		p.done(i, m.chunkLen(i), "sent")
+	}
+	if p.bytes > 0 {
+		fmt.Fprintln(progress)
+	}
+
+	// join the chunks, and only replace the target once verified
+	remote, tmp := ssh.ShellQuote(m.RemotePath), ssh.ShellQuote(m.RemotePath+assemblySuffix)
+	assemble := "cd " + stage + " && i=0; while [ $i -lt " + strconv.Itoa(len(m.Chunks)) + ` ]; do cat "$(printf %06d $i)" || exit 1; i=$((i+1)); done > ` + tmp + " && " +
+		`[ "$(sha256sum < ` + tmp + ` | cut -d' ' -f1)" = ` + m.SHA256 + ` ] || { echo "checksum mismatch after joining the chunks" >&2; exit 4; }; ` +
+		fmt.Sprintf("chmod %o %s && touch -d @%d %s && mv -f %s %s && cd / && rm -rf -- %s", m.Mode, tmp, m.ModTime, tmp, tmp, remote, stage)
+	if err = t.run(assemble, nil, nil); err != nil {
+		return fmt.Errorf("cannot join and verify the pushed file: %w", err)
+	}
+	out.Highlight(out.GetLevel(env), "pushed and verified %s (%s, sha256 %s)", m.RemotePath, formatBytes(m.Size), m.SHA256)
+	return os.Remove(manifestPath)
+}
+
+// parseChunkSums parses `sha256sum` lines of chunks, returning the checksum of each chunk (by name)
+func parseChunkSums(lines []string) map[string]string {
+	sums := make(map[string]string)
+	for _, line := range lines {
+		if sum, name, ok := strings.Cut(line, "  "); ok {
+			sums[name] = sum
+		}
+	}
+	return sums
+}
+
+// pullChunked pulls `remoteFile` from the instance to `target` in chunks, which can be resumed (`isResume`)
+// if the pull is interrupted. Chunks already pulled (matching the manifest) are not fetched again
+func pullChunked(cfg *config.Config, env config.Environment, instance aws.EC2Result, remoteFile, target string, chunkSize int64, isResume bool, progress io.Writer) error {
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		target = filepath.Join(target, path.Base(remoteFile))
+	}
+
+	t := newTransfer(cfg, env, instance)
+	lines, err := t.output("f=" + ssh.ShellQuote(remoteFile) + `; [ -f "$f" ] || { echo "not a file: $f" >&2; exit 2; }; readlink -f -- "$f" && stat -L -c '%s %Y %a' -- "$f"`)
+	if err != nil {
+		return fmt.Errorf("cannot find the file to pull: %w", err)
+	}
+	var resolved string
+	var size, modTime int64
+	var mode uint32
+	if len(lines) == 2 {
+		resolved = lines[0]
+		_, err = fmt.Sscanf(lines[1], "%d %d %o", &size, &modTime, &mode)
+	}
+	if resolved == "" || err != nil {
+		return fmt.Errorf("unexpected details of the file to pull: %q", lines)
+	}
+
+	manifestPath := getManifestPath(cfg, env, instance, true, remoteFile, target)
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	isResuming := isResume && m != nil && m.RemotePath == resolved && m.Size == size && m.ModTime == modTime
+	if isResume && !isResuming {
+		out.WarnFHighlight("no resumable pull of %s (or it has changed), so starting from the beginning", remoteFile)
+	}
+	if !isResuming {
+		m = &Manifest{Environment: env.Name, InstanceID: instance.InstanceId, IsPull: true, Source: remoteFile, Target: target,
+			RemotePath: resolved, Size: size, ModTime: modTime, Mode: mode, ChunkSize: chunkSize, Started: time.Now().UTC()}
+		// the checksums are computed remotely, to verify each chunk (and the whole file) as it arrives
+		f := ssh.ShellQuote(resolved)
+		sums, err := t.output(fmt.Sprintf(`sha256sum < %s | cut -d' ' -f1; i=0; while [ $i -lt %d ]; do dd if=%s bs=%d skip=$i count=1 2>/dev/null | sha256sum | cut -d' ' -f1; i=$((i+1)); done`,
+			f, countChunks(size, chunkSize), f, chunkSize))
+		if err != nil {
+			return fmt.Errorf("cannot get the checksums of the file to pull: %w", err)
+		}
+		if len(sums) != 1+countChunks(size, chunkSize) {
+			return fmt.Errorf("unexpected checksums of the file to pull: %q", sums)
+		}
+		m.SHA256, m.Chunks = sums[0], sums[1:]
+		if err = m.save(manifestPath); err != nil {
+			return err
+		}
+	}
+
+	stage := target + stagingSuffix
+	if !isResuming {
+		if err = os.RemoveAll(stage); err != nil {
+			return err
+		}
+	}
+	if err = os.MkdirAll(stage, 0700); err != nil {
+		return err
+	}
+
+	p := &chunkProgress{w: progress, started: time.Now(), total: len(m.Chunks)}
+	for i, sum := range m.Chunks {
+		local := filepath.Join(stage, chunkName(i))
+		if localSum, err := getFileSum(local); err == nil && localSum == sum {
+			continue
+		}
+		if err = fetchChunk(t, m, i, local); err != nil {
+			fmt.Fprintln(progress)
+			return getResumableError(err)
+		}
+		p.done(i, m.chunkLen(i), "pulled")
+	}
+	if p.bytes > 0 {
+		fmt.Fprintln(progress)
+	}
+
+	if err = joinChunks(m, stage, target); err != nil {
+		return err
+	}
+	if err = os.RemoveAll(stage); err != nil {
+		return err
+	}
+	out.Highlight(out.GetLevel(env), "pulled and verified %s (%s, sha256 %s)", target, formatBytes(m.Size), m.SHA256)
+	return os.Remove(manifestPath)
+}
+
+// fetchChunk pulls chunk `i` to `local`, checking it against the manifest
+func fetchChunk(t *transfer, m *Manifest, i int, local string) error {
+	tmp, err := os.Create(local + ".tmp")
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	err = t.run(fmt.Sprintf("dd if=%s bs=%d skip=%d count=1 2>/dev/null", ssh.ShellQuote(m.RemotePath), m.ChunkSize, i), nil, io.MultiWriter(tmp, h))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != m.Chunks[i] {
+		return fmt.Errorf("chunk %d does not match its checksum (has the remote file changed?)", i+1)
+	}
+	return os.Rename(local+".tmp", local)
+}
+
+// joinChunks joins the chunks in `stage` into `target`, only replacing it once verified
+func joinChunks(m *Manifest, stage, target string) error {
+	tmp := target + assemblySuffix
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(m.Mode).Perm())
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	for i := range m.Chunks {
+		chunk, err := os.Open(filepath.Join(stage, chunkName(i)))
+		if err != nil {
+			f.Close()
+			return err
+		}
+		_, err = io.Copy(io.MultiWriter(f, h), chunk)
+		chunk.Close()
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != m.SHA256 {
+		os.Remove(tmp)
+		return errors.New("checksum mismatch after joining the chunks")
+	}
+	modTime := time.Unix(m.ModTime, 0)
+	if err = os.Chtimes(tmp, modTime, modTime); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// getFileSum returns the SHA-256 checksum of the file
+func getFileSum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,308 @@
+package scp
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/out"
+	"github.com/ONSdigital/dp-cli/ssh"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressions for `--compress`
+const (
+	COMPRESS_GZIP = "gzip"
+	COMPRESS_ZSTD = "zstd"
+)
+
+// prefixes of the (stderr) lines which the remote command reports on
+const (
+	tarExitPrefix = "dp-tar-exit "
+	sha256Prefix  = "dp-sha256 "
+)
+
+// compressedPull is the outcome of a compressed pull
+type compressedPull struct {
+	Received  int64 // compressed bytes
+	Extracted int64
+	Files     int
+	Elapsed   time.Duration
+}
+
+// getCompressCommand returns the (remote) shell command which writes a tar of `srcFiles` (compressed with `compression`)
+// to stdout, then the SHA-256 checksums of the files to stderr. Each src is added to the tar as `./<its name>`
+func getCompressCommand(srcFiles []string, compression string) (string, error) {
+	compressor := "gzip -c"
+	switch compression {
+	case COMPRESS_GZIP:
+	case COMPRESS_ZSTD:
+		compressor = "zstd -c -q"
+	default:
+		return "", fmt.Errorf("unknown compression %q (use %s or %s)", compression, COMPRESS_GZIP, COMPRESS_ZSTD)
+	}
+
+	members, quoted := getTarMembers(srcFiles)
+	return "{ tar -c -h -f - " + members + `; echo "` + tarExitPrefix + `$?" >&2; } | ` + compressor + "; " +
+		"for p in " + strings.Join(quoted, " ") + `; do (cd -- "$(dirname -- "$p")" && find -L "./$(basename -- "$p")" -type f -exec sha256sum {} +) | sed 's/^/` + sha256Prefix + `/' >&2; done`, nil
+}
+
+// getTarMembers returns the `tar -c` args which add each of the (remote) `srcFiles` as `./<its name>`
+// (following symlinks, as scp does), and the `srcFiles` quoted for the remote shell
+func getTarMembers(srcFiles []string) (members string, quoted []string) {
+	args := make([]string, 0, len(srcFiles))
+	for _, src := range srcFiles {
+		q := ssh.ShellQuote(src)
+		quoted = append(quoted, q)
+		args = append(args, `-C "$(cd -- "$(dirname -- `+q+`)" && pwd)" "./$(basename -- `+q+`)"`)
+	}
+	return strings.Join(args, " "), quoted
+}
+
+// pullCompressed pulls `srcFiles` from the instance into the `target` dir as a compressed tar stream, then
+// verifies the checksums of the files against those computed remotely. Progress is shown on `progress` (if not nil),
+// and other remote errors are written to `stderr`
+func pullCompressed(cfg *config.Config, env config.Environment, instance aws.EC2Result, srcFiles []string, target, compression string, progress, stderr io.Writer) (result compressedPull, err error) {
+	remoteCmd, err := getCompressCommand(srcFiles, compression)
+	if err != nil {
+		return result, err
+	}
+	if err = os.MkdirAll(target, 0755); err != nil {
+		return result, err
+	}
+	c, err := ssh.RemoteCommand(cfg, env, instance, remoteCmd)
+	if err != nil {
+		return result, err
+	}
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return result, err
+	}
+	errPipe, err := c.StderrPipe()
+	if err != nil {
+		return result, err
+	}
+
+	started := time.Now()
+	if err = c.Start(); err != nil {
+		return result, err
+	}
+
+	// the remote checksums and tar exit code are reported on stderr
+	remoteSums := make(map[string]string)
+	tarExit := -1
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(errPipe)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if rest, ok := strings.CutPrefix(line, sha256Prefix); ok {
+				if sum, name, ok := strings.Cut(rest, "  "); ok {
+					remoteSums[path.Clean(name)] = strings.TrimPrefix(sum, `\`)
+				}
+			} else if rest, ok := strings.CutPrefix(line, tarExitPrefix); ok {
+				tarExit, _ = strconv.Atoi(rest)
+			} else {
+				fmt.Fprintln(stderr, line)
+			}
+		}
+	}()
+
+	counter := &countingReader{r: stdout}
+	stopProgress := showProgress(progress, "received", counter, started)
+	localSums, extracted, extractErr := extract(counter, target, compression)
+	stopProgress()
+	// drain (e.g. after an error, or padding after the tar), so the remote command is not blocked writing
+	io.Copy(io.Discard, counter)
+	wg.Wait()
+	waitErr := c.Wait()
+
+	result = compressedPull{Received: counter.Count(), Extracted: extracted, Files: len(localSums), Elapsed: time.Since(started)}
+	switch {
+	case extractErr != nil:
+		return result, fmt.Errorf("cannot unpack the pull: %w", extractErr)
+	case waitErr != nil:
+		return result, waitErr
+	case tarExit != 0:
+		return result, fmt.Errorf("remote tar failed (exit code %d)", tarExit)
+	}
+	return result, verifySums(remoteSums, localSums)
+}
+
+// extract unpacks the (compressed) tar stream into `target`, returning the SHA-256 checksum of each file (by its name in the tar)
+func extract(r io.Reader, target, compression string) (sums map[string]string, extracted int64, err error) {
+	switch compression {
+	case COMPRESS_ZSTD:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer gzr.Close()
+		r = gzr
+	}
+
+	sums = make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return sums, extracted, nil
+		} else if err != nil {
+			return sums, extracted, err
+		}
+
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return sums, extracted, fmt.Errorf("unsafe path in tar: %q", hdr.Name)
+		}
+		local := filepath.Join(target, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(local, 0755); err != nil {
+				return sums, extracted, err
+			}
+		case tar.TypeReg:
+			if err = os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+				return sums, extracted, err
+			}
+			sum, n, err := writeFile(local, tr, hdr)
+			extracted += n
+			if err != nil {
+				return sums, extracted, err
+			}
+			sums[name] = sum
+		default:
+			// files are dereferenced remotely, so nothing else is expected
+			out.WarnFHighlight("skipping %s (not a file or dir)", hdr.Name)
+		}
+	}
+}
+
+// writeFile writes the file (preserving its mode and mtime, as `scp -p` does), returning its checksum
+func writeFile(local string, r io.Reader, hdr *tar.Header) (sum string, n int64, err error) {
+	f, err := os.OpenFile(local, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+	if err != nil {
+		return "", 0, err
+	}
+	h := sha256.New()
+	n, err = io.Copy(io.MultiWriter(f, h), r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", n, err
+	}
+	if err = os.Chtimes(local, hdr.ModTime, hdr.ModTime); err != nil {
+		return "", n, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// verifySums reports (and returns an error for) files whose local checksum does not match the remote one, or which are missing
+func verifySums(remoteSums, localSums map[string]string) error {
+	if len(remoteSums) == 0 && len(localSums) > 0 {
+		return errors.New("no checksums were received from the remote host")
+	}
+	names := make([]string, 0, len(remoteSums))
+	for name := range remoteSums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failures := 0
+	for _, name := range names {
+		local, ok := localSums[name]
+		if !ok {
+			failures++
+			out.ErrorFHighlight("%s: missing (not in the pull)", name)
+		} else if local != remoteSums[name] {
+			failures++
+			out.ErrorFHighlight("%s: checksum mismatch (remote %s, local %s)", name, remoteSums[name], local)
+		}
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d of %d file(s) failed verification (files may have changed during the pull)", failures, len(names))
+	}
+	return nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r     io.Reader
+	count atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.count.Add(int64(n))
+	return n, err
+}
+
+// Count is the number of bytes read
+func (c *countingReader) Count() int64 {
+	return c.count.Load()
+}
+
+// showProgress shows the bytes counted (after `label`, e.g. "received") and transfer rate on `w` (if not nil)
+// until the returned func is called
+func showProgress(w io.Writer, label string, counter *countingReader, started time.Time) (stop func()) {
+	if w == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				fmt.Fprintf(w, "\r%s %s\n", label, formatProgress(counter.Count(), time.Since(started)))
+				return
+			case <-ticker.C:
+				fmt.Fprintf(w, "\r%s %s", label, formatProgress(counter.Count(), time.Since(started)))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// formatProgress returns e.g. `12.0 MiB (3.0 MiB/s)`
+func formatProgress(n int64, elapsed time.Duration) string {
+	rate := int64(0)
+	if secs := elapsed.Seconds(); secs > 0 {
+		rate = int64(float64(n) / secs)
+	}
+	return fmt.Sprintf("%s (%s/s)   ", formatBytes(n), formatBytes(rate))
+}
@@ -0,0 +1,194 @@
+package scp
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/ssh"
+)
+
+// globChars are the characters which are special in remote patterns (and escaped with `\` to be literal)
+const globChars = `*?[]\`
+
+// QuotePattern returns the remote pattern `p` quoted for the remote shell, leaving only its glob characters
+// (`*`, `?` and `[...]`) special, so that spaces, quotes and other shell metacharacters are taken literally.
+// A `\` makes the next character literal, and a leading `~/` is the remote home dir
+func QuotePattern(p string) string {
+	p = trimHome(p)
+
+	var quoted, literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			quoted.WriteString(ssh.ShellQuote(literal.String()))
+			literal.Reset()
+		}
+	}
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '\\':
+			if i+1 < len(p) {
+				i++
+			}
+			literal.WriteByte(p[i])
+		case '*', '?':
+			flush()
+			quoted.WriteByte(c)
+		case '[':
+			end := getBracketEnd(p, i)
+			if end < 0 {
+				literal.WriteByte(c)
+				continue
+			}
+			flush()
+			quoted.WriteByte('[')
+			for j := i + 1; j < end; j++ {
+				if b := p[j]; b == '!' || b == '^' || b == '-' || b == ']' || ssh.ShellQuote(string(b)) == string(b) {
+					quoted.WriteByte(b)
+				} else {
+					quoted.WriteString(ssh.ShellQuote(string(b)))
+				}
+			}
+			quoted.WriteByte(']')
+			i = end
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	flush()
+	if quoted.Len() == 0 {
+		return "''"
+	}
+	return quoted.String()
+}
+
+// getBracketEnd returns the index of the `]` closing the bracket expression opened at `p[start]`, or -1 if none.
+// A `]` first in the expression (after any `!` or `^`) is a member of it, not its end
+func getBracketEnd(p string, start int) int {
+	i := start + 1
+	if i < len(p) && (p[i] == '!' || p[i] == '^') {
+		i++
+	}
+	if i < len(p) && p[i] == ']' {
+		i++
+	}
+	for ; i < len(p); i++ {
+		switch p[i] {
+		case ']':
+			return i
+		case '/':
+			return -1 // a bracket expression cannot span dirs
+		}
+	}
+	return -1
+}
+
+// EscapeGlob returns the path `p` with its glob characters escaped, i.e. as a pattern matching only `p`
+func EscapeGlob(p string) string {
+	var b strings.Builder
+	for _, r := range p {
+		if strings.ContainsRune(globChars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// getExpandCommand returns the (remote) shell command which expands each of the `patterns`, writing
+// `<index>\t<match>` (NUL-terminated) for each match, or `<index>\t` for a pattern which matches nothing
+func getExpandCommand(patterns []string) string {
+	var b strings.Builder
+	for i, p := range patterns {
+		fmt.Fprintf(&b, `set -- %s; if [ "$#" -eq 1 ] && [ ! -e "$1" ] && [ ! -L "$1" ]; then printf '%d\t\0'; else for m; do printf '%d\t%%s\0' "$m"; done; fi; `, QuotePattern(p), i, i)
+	}
+	return strings.TrimSuffix(b.String(), " ")
+}
+
+// parseExpansions parses the output of the getExpandCommand, returning the matches (in order) and the
+// patterns which matched nothing
+func parseExpansions(output []byte, patterns []string) (matches, unmatched []string, err error) {
+	for _, record := range strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00") {
+		if record == "" {
+			continue
+		}
+		index, match, isOK := strings.Cut(record, "\t")
+		i, err := strconv.Atoi(index)
+		if !isOK || err != nil || i < 0 || i >= len(patterns) {
+			return nil, nil, fmt.Errorf("unexpected remote expansion: %q", record)
+		}
+		if match == "" {
+			unmatched = append(unmatched, patterns[i])
+			continue
+		}
+		matches = append(matches, match)
+	}
+	return matches, unmatched, nil
+}
+
+// expandRemote expands the `patterns` on the instance, returning the (literal) paths they match.
+// It is an error if any pattern matches nothing
+func expandRemote(cfg *config.Config, env config.Environment, instance aws.EC2Result, patterns []string) ([]string, error) {
+	c, err := ssh.RemoteCommand(cfg, env, instance, getExpandCommand(patterns))
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	output, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot expand the files to pull on %s: %w: %s", instance.InstanceId, err, strings.TrimSpace(stderr.String()))
+	}
+	matches, unmatched, err := parseExpansions(output, patterns)
+	if err != nil {
+		return nil, err
+	}
+	if len(unmatched) > 0 {
+		return nil, fmt.Errorf("no match on %s (%s) for: %s", strings.Join(instance.GroupAKA, ", "), instance.InstanceId, strings.Join(unmatched, ", "))
+	}
+	return matches, nil
+}
+
+// getRemoteArg returns the scp arg for the literal remote `path`. The legacy scp protocol passes the path
+// through the remote shell (so it is quoted), whereas the SFTP protocol (the default from OpenSSH 9.0) only
+// expands globs in it (so they are escaped). Relative paths (including `~/...`) are in the remote home dir
+func getRemoteArg(userHost, path string, isSFTP bool) string {
+	path = trimHome(path)
+	if isSFTP {
+		return userHost + ":" + EscapeGlob(path)
+	}
+	return userHost + ":" + ssh.ShellQuote(path)
+}
+
+var (
+	opensshVersion = regexp.MustCompile(`OpenSSH_(\d+)\.`)
+	isSFTPOnce     sync.Once
+	isSFTP         bool
+)
+
+// isSFTPProtocol returns whether the local scp uses the SFTP protocol by default (OpenSSH 9.0 or later)
+func isSFTPProtocol() bool {
+	isSFTPOnce.Do(func() {
+		// `ssh -V` writes its version to stderr
+		output, _ := exec.Command("ssh", "-V").CombinedOutput()
+		isSFTP = usesSFTP(string(output))
+	})
+	return isSFTP
+}
+
+// usesSFTP returns whether the scp of the `ssh -V` version uses the SFTP protocol by default.
+// If the version is unknown, it is assumed to be recent
+func usesSFTP(version string) bool {
+	m := opensshVersion.FindStringSubmatch(version)
+	if m == nil {
+		return true
+	}
+	major, _ := strconv.Atoi(m[1])
+	return major >= 9
+}
@@ -0,0 +1,265 @@
+package scp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/out"
+	"github.com/ONSdigital/dp-cli/ssh"
+)
+
+// declarations (in the audit) of how the pull was declared non-sensitive
+const (
+	DECLARED_BY_PROMPT = "prompt"
+	DECLARED_BY_FLAG   = "flag" // `--confirm-non-sensitive`
+)
+
+// RemoteFile is a file which a pull would copy
+type RemoteFile struct {
+	Path   string `json:"path"` // absolute, with symlinks resolved
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+
+	root string // the (resolved) src which the file was listed under
+}
+
+// PullAudit is the record (a line in the audit file) of a pull declared to be non-sensitive
+type PullAudit struct {
+	Time        time.Time    `json:"time"`
+	User        string       `json:"user,omitempty"`
+	Environment string       `json:"environment"`
+	Instance    string       `json:"instance"` // e.g. "publishing 1"
+	InstanceID  string       `json:"instance_id"`
+	Declaration string       `json:"declaration"` // one of DECLARED_BY_*
+	SrcFiles    []string     `json:"src_files"`
+	Target      string       `json:"target"`
+	Files       []RemoteFile `json:"files"`
+}
+
+// getListCommand returns the (remote) shell command which lists the files a pull of `srcFiles` would copy, as
+// NUL-terminated records of `<size>\t<path>`, each src preceded by a record of `\t<src path>`. The `srcFiles` are
+// patterns (see QuotePattern), and paths are resolved (following symlinks, as scp does) so they can be checked
+func getListCommand(srcFiles []string) string {
+	quoted := make([]string, len(srcFiles))
+	for i, src := range srcFiles {
+		quoted[i] = QuotePattern(src)
+	}
+	return "for p in " + strings.Join(quoted, " ") + "; do " +
+		`f=$(readlink -f -- "$p") && [ -e "$f" ] || { echo "no such file: $p" >&2; exit 2; }; ` +
+		`printf '\t%s\0' "$f"; ` +
+		`find -L "$f" -type f -exec stat -L --printf '%s\t%n\0' -- {} + || exit 3; ` +
+		"done"
+}
+
+// parseRemoteFiles parses the output of the getListCommand
+func parseRemoteFiles(output []byte) ([]RemoteFile, error) {
+	var files []RemoteFile
+	var root string
+	for _, record := range strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00") {
+		if record == "" {
+			continue
+		}
+		size, path, isOK := strings.Cut(record, "\t")
+		if isOK && size == "" {
+			root = path
+			continue
+		}
+		n, err := strconv.ParseInt(size, 10, 64)
+		if !isOK || err != nil {
+			return nil, fmt.Errorf("unexpected record in remote file list: %q", record)
+		}
+		files = append(files, RemoteFile{Path: path, Size: n, root: root})
+	}
+	return files, nil
+}
+
+// listRemoteFiles lists the files that a pull of `srcFiles` from the instance would copy (without their checksums)
+func listRemoteFiles(cfg *config.Config, env config.Environment, instance aws.EC2Result, srcFiles []string) ([]RemoteFile, error) {
+	c, err := ssh.RemoteCommand(cfg, env, instance, getListCommand(srcFiles))
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	output, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list the files to pull from %s: %w: %s", instance.InstanceId, err, strings.TrimSpace(stderr.String()))
+	}
+	return parseRemoteFiles(output)
+}
+
+// getRelativePath returns the path of the file relative to the src it was listed under (its name, if it is the src)
+func (f RemoteFile) getRelativePath() string {
+	if f.Path == f.root {
+		return path.Base(f.Path)
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(f.Path, f.root), "/")
+}
+
+// addChecksums sets the SHA256 of each of the `files` on the instance. The paths are sent on stdin
+// (NUL-terminated), and sha256sum writes a line per file in the same order
+func addChecksums(cfg *config.Config, env config.Environment, instance aws.EC2Result, files []RemoteFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+	c, err := ssh.RemoteCommand(cfg, env, instance, "xargs -0 sha256sum --")
+	if err != nil {
+		return err
+	}
+	var stdin strings.Builder
+	for _, file := range files {
+		stdin.WriteString(file.Path + "\x00")
+	}
+	var stderr bytes.Buffer
+	c.Stdin, c.Stderr = strings.NewReader(stdin.String()), &stderr
+	output, err := c.Output()
+	if err != nil {
+		return fmt.Errorf("cannot checksum the files to pull from %s: %w: %s", instance.InstanceId, err, strings.TrimSpace(stderr.String()))
+	}
+	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	if len(lines) != len(files) {
+		return fmt.Errorf("expected %d checksums from %s, but got %d", len(files), instance.InstanceId, len(lines))
+	}
+	for i, line := range lines {
+		// sha256sum escapes (with a leading `\`) names containing `\` or a newline
+		sum, _, isOK := strings.Cut(strings.TrimPrefix(line, `\`), "  ")
+		if !isOK || len(sum) != 64 {
+			return fmt.Errorf("unexpected line in remote checksums: %q", line)
+		}
+		files[i].SHA256 = sum
+	}
+	return nil
+}
+
+// checkPullPolicy returns an error if the policy does not allow the files to be pulled
+func checkPullPolicy(policy config.Policy, files []RemoteFile) error {
+	maxBytes, err := policy.GetPullMaxBytes()
+	if err != nil {
+		return err
+	}
+	var denials []string
+	var total int64
+	for _, file := range files {
+		if glob, isDenied := policy.GetPullDenial(file.Path); isDenied {
+			denials = append(denials, fmt.Sprintf("%s (pull-deny-paths: %s)", file.Path, glob))
+		}
+		total += file.Size
+	}
+	if len(denials) > 0 {
+		return fmt.Errorf("the policy does not allow pulling:\n  %s", strings.Join(denials, "\n  "))
+	}
+	if maxBytes > 0 && total > maxBytes {
+		return fmt.Errorf("the pull is %s, more than the policy's pull-max-size of %s", formatBytes(total), policy.PullMaxSize)
+	}
+	return nil
+}
+
+// ApprovePull checks the files that a pull from the instances would copy against the environment's policy, then
+// asks for the legal declaration (unless `isConfirmed`) and records it in the audit file
+func ApprovePull(cfg *config.Config, env config.Environment, instances []aws.EC2Result, srcFiles []string, target string, isConfirmed bool) error {
+	return approvePull(cfg, env, instances, srcFiles, nil, target, isConfirmed)
+}
+
+// approvePull is ApprovePull for a pull which skips the files matching the (rsync) `excludes`
+func approvePull(cfg *config.Config, env config.Environment, instances []aws.EC2Result, srcFiles, excludes []string, target string, isConfirmed bool) error {
+	policy := env.GetPolicy()
+	if !policy.NeedsPullDeclaration() && len(policy.PullDenyPaths) == 0 && policy.PullMaxSize == "" {
+		return nil
+	}
+
+	audits := make([]PullAudit, 0, len(instances))
+	var countFiles int
+	var total int64
+	for _, instance := range instances {
+		listed, err := listRemoteFiles(cfg, env, instance, srcFiles)
+		if err != nil {
+			return err
+		}
+		files := make([]RemoteFile, 0, len(listed))
+		for _, file := range listed {
+			if !isExcluded(file.getRelativePath(), excludes) {
+				files = append(files, file)
+			}
+		}
+		if err = checkPullPolicy(policy, files); err != nil {
+			return fmt.Errorf("%s (%s): %w", strings.Join(instance.GroupAKA, ", "), instance.InstanceId, err)
+		}
+		audits = append(audits, PullAudit{
+			Environment: env.Name,
+			Instance:    instance.Name,
+			InstanceID:  instance.InstanceId,
+			SrcFiles:    srcFiles,
+			Target:      target,
+			Files:       files,
+		})
+		countFiles += len(files)
+		for _, file := range files {
+			total += file.Size
+		}
+	}
+	if !policy.NeedsPullDeclaration() {
+		return nil
+	}
+	// only checksum (for the audit) once the files are known to be allowed
+	for i, instance := range instances {
+		if err := addChecksums(cfg, env, instance, audits[i].Files); err != nil {
+			return err
+		}
+	}
+
+	out.Highlight(out.GetLevel(env), "pulling %s file(s), %s in total", countFiles, formatBytes(total))
+	declaration := DECLARED_BY_FLAG
+	if !isConfirmed {
+		if err := declareNotSensitive(); err != nil {
+			return err
+		}
+		declaration = DECLARED_BY_PROMPT
+	}
+
+	var user string
+	if cfg.UserName != nil {
+		user = *cfg.UserName
+	}
+	now := time.Now().UTC()
+	for i := range audits {
+		audits[i].Time, audits[i].User, audits[i].Declaration = now, user, declaration
+	}
+	if err := writeAudit(cfg.GetPullAuditFile(), audits); err != nil {
+		return fmt.Errorf("cannot record the declaration (so not pulling): %w", err)
+	}
+	return nil
+}
+
+// writeAudit appends the audit records (one JSON object per line) to the audit file
+func writeAudit(auditFile string, audits []PullAudit) error {
+	if err := os.MkdirAll(filepath.Dir(auditFile), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(auditFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, audit := range audits {
+		b, err := json.Marshal(audit)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		buf.Write(append(b, '\n'))
+	}
+	if _, err = f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
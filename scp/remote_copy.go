@@ -0,0 +1,161 @@
+package scp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/confirm"
+	"github.com/ONSdigital/dp-cli/out"
+	"github.com/ONSdigital/dp-cli/ssh"
+)
+
+// getSendCommand returns the (remote) shell command which writes a tar of `srcFiles` to stdout.
+// Unless `isRecursing`, it fails if any of them is a dir
+func getSendCommand(srcFiles []string, isRecursing bool) string {
+	members, quoted := getTarMembers(srcFiles)
+	remoteCmd := "tar -c -h -f - " + members
+	if !isRecursing {
+		remoteCmd = "for p in " + strings.Join(quoted, " ") + `; do if [ -d "$p" ]; then echo "is a dir (use -r): $p" >&2; exit 2; fi; done; ` + remoteCmd
+	}
+	return remoteCmd
+}
+
+// getReceiveCommand returns the (remote) shell command which unpacks a tar (of `srcFiles`, from stdin) into `target`,
+// preserving modes and modification times. If `target` is not a dir, the single src is unpacked as `target`
+func getReceiveCommand(srcFiles []string, target string) string {
+	if target = trimHome(target); target == "" {
+		target = "."
+	}
+	d := "d=" + ssh.ShellQuote(target) + "; "
+	if len(srcFiles) > 1 {
+		return d + `[ -d "$d" ] || { echo "not a dir: $d" >&2; exit 2; }; tar -x -p -f - -C "$d"`
+	}
+	// unpack next to the target, then rename (so a failed copy leaves no partial target)
+	return d + `if [ -d "$d" ]; then tar -x -p -f - -C "$d"; else ` +
+		`t=$(mktemp -d "$(dirname -- "$d")/.dp-copy.XXXXXX") || exit 2; ` +
+		`tar -x -p -f - -C "$t" && mv -f -- "$t"/` + ssh.ShellQuote(path.Base(srcFiles[0])) + ` "$d"; s=$?; rm -rf -- "$t"; exit $s; fi`
+}
+
+// getDirectCommand returns the (remote) shell command for `src` which sends the tar of `srcFiles` straight to
+// `dstUserHost` over ssh (authenticated by the forwarded agent). The host key of the target must already be known on `src`
+func getDirectCommand(dstUserHost string, srcFiles []string, isRecursing bool, target string) string {
+	return getSendCommand(srcFiles, isRecursing) + " | ssh -o BatchMode=yes " +
+		ssh.ShellQuote(dstUserHost) + " " + ssh.ShellQuote(getReceiveCommand(srcFiles, target))
+}
+
+// CopyBetween copies `srcFiles` (patterns, see QuotePattern) on the instance `src` to `target` on the instance `dst`
+// of the environment. The files are streamed through the local machine (without touching its disk), or with
+// IsDirect, straight from `src` to `dst` (when the network allows). The copy is checked against the environment's
+// policy as a pull from `src`, and confirmed as a push to `dst`
+func CopyBetween(cfg *config.Config, env config.Environment, src aws.EC2Result, srcFiles []string, dst aws.EC2Result, target string, opts Options) error {
+	if cfg.SSHUser == nil || len(*cfg.SSHUser) == 0 {
+		return errors.New("missing `ssh-user` in config file")
+	}
+	if src.InstanceId == dst.InstanceId {
+		return errors.New("the source and target are the same instance (use `dp ssh` to copy files on it)")
+	}
+	isDirect := opts.IsDirect != nil && *opts.IsDirect
+	if isDirect && !env.GetPolicy().IsDirectCopyAllowed() {
+		return fmt.Errorf("the policy of %s does not allow `--direct` (allow-direct-copy), as it forwards your ssh agent to the instance", env.Name)
+	}
+	// the source reaches the target as `dp ssh` does, which it can only do by IP (not via SSM)
+	if isDirect && !env.GetPolicy().IsSSHByIP() {
+		return fmt.Errorf("`--direct` needs the policy of %s to have `ssh-target: ip`, as instances reached via SSM cannot be reached from each other", env.Name)
+	}
+	if isDirect && dst.IPAddress == "" {
+		return fmt.Errorf("`--direct` needs an IP address for %s", dst.InstanceId)
+	}
+	srcName := fmt.Sprintf("%s (%s)", strings.Join(src.GroupAKA, ", "), src.InstanceId)
+	dstName := fmt.Sprintf("%s (%s)", strings.Join(dst.GroupAKA, ", "), dst.InstanceId)
+
+	lvl := out.GetLevel(env)
+	out.Highlight(lvl, "SCP copying for %s (%s:%s -> %s:%s)", env.Name, srcName, strings.Join(srcFiles, ", "), dstName, target)
+
+	files, err := expandRemote(cfg, env, src, srcFiles)
+	if err != nil {
+		return err
+	}
+	if err = ApprovePull(cfg, env, []aws.EC2Result{src}, srcFiles, dst.InstanceId+":"+target, *opts.IsConfirmed); err != nil {
+		return err
+	}
+	action := fmt.Sprintf("copy %s from %s to %s on %s", strings.Join(srcFiles, ", "), srcName, target, dstName)
+	if err = confirm.Environment(env, action, opts.AssumeYes != nil && *opts.AssumeYes); err != nil {
+		return err
+	}
+
+	started := time.Now()
+	if isDirect {
+		dstUserHost, _ := ssh.GetUserHost(cfg, env, dst)
+		c, err := ssh.RemoteCommandWithOptions(cfg, env, src, []string{"-A"}, getDirectCommand(dstUserHost, files, *opts.IsRecursing, target))
+		if err != nil {
+			return err
+		}
+		c.Stdout, c.Stderr = os.Stderr, os.Stderr
+		if err = c.Run(); err != nil {
+			return fmt.Errorf("direct copy from %s to %s failed (try without `--direct`): %w", srcName, dstName, err)
+		}
+		out.Highlight(lvl, "copied %s in %s", strings.Join(files, ", "), time.Since(started).Round(time.Millisecond))
+		return nil
+	}
+
+	n, err := streamBetween(cfg, env, src, dst, getSendCommand(files, *opts.IsRecursing), getReceiveCommand(files, target))
+	if err != nil {
+		return err
+	}
+	out.Highlight(lvl, "copied %s (%s) in %s", strings.Join(files, ", "), formatBytes(n), time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// streamBetween pipes the output of `sendCmd` on `src` into `receiveCmd` on `dst`, showing progress,
+// and returns the bytes streamed
+func streamBetween(cfg *config.Config, env config.Environment, src, dst aws.EC2Result, sendCmd, receiveCmd string) (int64, error) {
+	sendC, err := ssh.RemoteCommand(cfg, env, src, sendCmd)
+	if err != nil {
+		return 0, err
+	}
+	receiveC, err := ssh.RemoteCommand(cfg, env, dst, receiveCmd)
+	if err != nil {
+		return 0, err
+	}
+	stdout, err := sendC.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	var sendErr, receiveErr bytes.Buffer
+	counter := &countingReader{r: stdout}
+	sendC.Stderr, receiveC.Stdin, receiveC.Stderr = &sendErr, counter, &receiveErr
+
+	if err = sendC.Start(); err != nil {
+		return 0, err
+	}
+	if err = receiveC.Start(); err != nil {
+		sendC.Process.Kill()
+		sendC.Wait()
+		return 0, err
+	}
+	stopProgress := showProgress(os.Stderr, "copied", counter, time.Now())
+	receiveWaitErr := receiveC.Wait()
+	if receiveWaitErr != nil {
+		// the sender may be blocked writing to a receiver which has gone
+		sendC.Process.Kill()
+	}
+	sendWaitErr := sendC.Wait()
+	stopProgress()
+
+	switch {
+	case receiveWaitErr != nil && sendWaitErr != nil && sendErr.Len() > 0:
+		return counter.Count(), fmt.Errorf("cannot send from %s: %w: %s", src.InstanceId, sendWaitErr, strings.TrimSpace(sendErr.String()))
+	case receiveWaitErr != nil:
+		return counter.Count(), fmt.Errorf("cannot receive on %s: %w: %s", dst.InstanceId, receiveWaitErr, strings.TrimSpace(receiveErr.String()))
+	case sendWaitErr != nil:
+		return counter.Count(), fmt.Errorf("cannot send from %s: %w: %s", src.InstanceId, sendWaitErr, strings.TrimSpace(sendErr.String()))
+	}
+	return counter.Count(), nil
+}
@@ -2,24 +2,52 @@ package scp
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/cli"
+	"github.com/ONSdigital/dp-cli/clipboard"
 	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/confirm"
 	"github.com/ONSdigital/dp-cli/out"
+	"github.com/ONSdigital/dp-cli/ssh"
 )
 
 // Options holds the state of flags given
 type Options struct {
-	IsPull      *bool
-	IsRecursing *bool
-	IsConfirmed *bool
-	Verbosity   *int
+	IsPull         *bool
+	IsRecursing    *bool
+	IsConfirmed    *bool
+	Verbosity      *int
+	AssumeYes      *bool
+	InstanceNumMax *int
+	IsAll          *bool
+	Compress       *string // pull as a compressed tar (one of COMPRESS_*), if set
+	IsChunked      *bool   // copy in chunks, which can be resumed
+	ChunkSize      *string
+	IsResume       *bool               // resume an interrupted chunked copy (implies IsChunked)
+	Backend        *string             // one of BACKEND_* (default: the config's `scp-backend`)
+	IsDirect       *bool               // copy between instances directly, not via the local machine
+	IsClipboard    *bool               // pull to (or push from) the clipboard
+	Clipboard      clipboard.Clipboard // for IsClipboard (default: the OS clipboard)
+}
+
+// hostResult is the outcome of the copy for one instance of a multi-instance run
+type hostResult struct {
+	instance aws.EC2Result
+	srcFiles []string // the remote files matched, for pulls
+	dir      string   // per-host dir for pulls
+	bytes    int64
+	err      error
+	stderr   string
 }
 
 func withCWD(file string) (string, error) {
@@ -34,12 +62,90 @@ func withCWD(file string) (string, error) {
 	return filepath.Join(currentDir, file), nil
 }
 
-// Launch an scp file copy to/from the specified environment
-func Launch(cfg *config.Config, env config.Environment, instance aws.EC2Result, opts Options, srcFiles []string, target string) (err error) {
+// getInstanceRange returns the (zero-based, inclusive) range of instances to copy to/from,
+// from `instanceNum` and the `--to` and `--all` flags
+func getInstanceRange(instanceNum, countInstances int, opts Options) (first, last int, err error) {
+	first, last = instanceNum, instanceNum
+	if opts.IsAll != nil && *opts.IsAll {
+		return 0, countInstances - 1, nil
+	}
+	if opts.InstanceNumMax != nil {
+		switch max := *opts.InstanceNumMax; {
+		case max == 0:
+			last = countInstances - 1
+		case max > 0:
+			last = max - 1
+		}
+	}
+	if last >= countInstances {
+		return 0, 0, fmt.Errorf("no instance %d (there are %d)", last+1, countInstances)
+	}
+	if last < first {
+		return 0, 0, fmt.Errorf("`--to %d` is before instance %d", last+1, first+1)
+	}
+	return first, last, nil
+}
+
+// getHostDir returns the name of the per-host dir for pulls from the instance, e.g. `publishing-2`
+func getHostDir(instance aws.EC2Result) string {
+	if len(instance.GroupAKA) > 0 {
+		return strings.ReplaceAll(instance.GroupAKA[0], " ", "-")
+	}
+	return instance.InstanceId
+}
+
+// Launch an scp file copy to/from the specified environment's instance `instanceNum` (zero-based) of `instances`
+// (or a range of them, see Options)
+func Launch(cfg *config.Config, env config.Environment, instances []aws.EC2Result, instanceNum int, opts Options, srcFiles []string, target string) (err error) {
 	if cfg.SSHUser == nil || len(*cfg.SSHUser) == 0 {
 		out.Highlight(out.WARN, "no %s is defined in your configuration file you can view the app configuration values using the %s command", "ssh-user", "spew config")
 		return errors.New("missing `ssh-user` in config file")
 	}
+	first, last, err := getInstanceRange(instanceNum, len(instances), opts)
+	if err != nil {
+		return err
+	}
+	selected := instances[first : last+1]
+	backend, err := getBackend(cfg, opts)
+	if err != nil {
+		return err
+	}
+
+	compression := ""
+	if opts.Compress != nil {
+		compression = *opts.Compress
+	}
+	if compression != "" {
+		if !*opts.IsPull {
+			return errors.New("`--compress` is only for pulls")
+		}
+		if _, err = getCompressCommand(srcFiles, compression); err != nil {
+			return err
+		}
+	}
+
+	isResume := opts.IsResume != nil && *opts.IsResume
+	isChunked := isResume || (opts.IsChunked != nil && *opts.IsChunked)
+	var chunkSize int64
+	if isChunked {
+		if len(selected) > 1 || len(srcFiles) > 1 || compression != "" || *opts.IsRecursing {
+			return errors.New("`--chunked` and `--resume` are for copying a single file to/from a single instance (without `--compress` or `-r`)")
+		}
+		size := DEFAULT_CHUNK_SIZE
+		if opts.ChunkSize != nil && *opts.ChunkSize != "" {
+			size = *opts.ChunkSize
+		}
+		if chunkSize, err = config.ParseSize(size); err != nil || chunkSize < 1 {
+			return fmt.Errorf("bad `--chunk-size`: %v", size)
+		}
+	}
+
+	if isStreaming(opts, srcFiles, target) {
+		if len(selected) > 1 || isChunked || compression != "" || *opts.IsRecursing {
+			return errors.New("`-` and `--clipboard` are for copying a single file to/from a single instance (without `--compress`, `--chunked` or `-r`)")
+		}
+		return launchStream(cfg, env, selected[0], opts, srcFiles, target, os.Stdin, os.Stdout)
+	}
 
 	ansibleDir := cfg.GetAnsibleDirectory(env)
 
@@ -50,20 +156,13 @@ func Launch(cfg *config.Config, env config.Environment, instance aws.EC2Result,
 	if *opts.IsRecursing {
 		flags += "r"
 	}
-	cmdArgs := []string{flags + "F", "ssh.cfg"}
-	sshUser := *cfg.SSHUser
-	if len(env.SSHUser) > 0 {
-		sshUser = env.SSHUser
+	if len(selected) > 1 {
+		flags += "q" // no progress meters, as the copies are concurrent
 	}
-	for _, srcFile := range srcFiles {
-		if *opts.IsPull {
-			if env.IsAWSA() {
-				srcFile = fmt.Sprintf("%s@%s:%s", sshUser, instance.IPAddress, srcFile)
-			} else {
-				os.Setenv("AWS_PROFILE", cfg.GetProfile(env.Name))
-				srcFile = fmt.Sprintf("%s@%s:%s", sshUser, instance.InstanceId, srcFile)
-			}
-		} else {
+
+	var localFiles []string
+	if !*opts.IsPull {
+		for _, srcFile := range srcFiles {
 			if srcFile, err = withCWD(srcFile); err != nil {
 				out.Highlight(out.WARN, "could not determine your cwd")
 				return err
@@ -72,8 +171,8 @@ func Launch(cfg *config.Config, env config.Environment, instance aws.EC2Result,
 				out.Highlight(out.WARN, "could not access source file: %s", srcFile)
 				return err
 			}
+			localFiles = append(localFiles, srcFile)
 		}
-		cmdArgs = append(cmdArgs, srcFile)
 	}
 	verb := "pushing"
 	if *opts.IsPull {
@@ -82,38 +181,266 @@ func Launch(cfg *config.Config, env config.Environment, instance aws.EC2Result,
 			out.Highlight(out.WARN, "could not determine your cwd")
 			return err
 		}
-	} else {
-		if env.IsAWSA() {
-			target = fmt.Sprintf("%s@%s:%s", sshUser, instance.IPAddress, target)
-		} else {
-			os.Setenv("AWS_PROFILE", cfg.GetProfile(env.Name))
-			target = fmt.Sprintf("%s@%s:%s", sshUser, instance.InstanceId, target)
-		}
 	}
-	cmdArgs = append(cmdArgs, target)
 
 	lvl := out.GetLevel(env)
 	out.Highlight(lvl, "SCP %s for %s (%s -> %s)", verb, env.Name, strings.Join(srcFiles, ", "), target)
-	out.Highlight(lvl, "[IP: %s | Name: %s | Id %s | Groups %s | AKA %s]", instance.IPAddress, instance.Name, instance.InstanceId, instance.AnsibleGroups, strings.Join(instance.GroupAKA, ", "))
-
-	if *opts.IsPull && env.IsSecure() && !*opts.IsConfirmed {
-		reader := bufio.NewReader(os.Stdin)
-		for {
-			fmt.Print("Legal declaration: I confirm that I am NOT copying sensitive files (yes/no): ")
-			yorn, _ := reader.ReadString('\n')
-			if yorn == "yes\n" {
-				break
-			} else if yorn == "no\n" {
-				return errors.New("failed to confirm legal declaration")
+	for _, instance := range selected {
+		out.Highlight(lvl, "[IP: %s | Name: %s | Id %s | Groups %s | AKA %s]", instance.IPAddress, instance.Name, instance.InstanceId, instance.AnsibleGroups, strings.Join(instance.GroupAKA, ", "))
+	}
+
+	// the patterns are expanded remotely, so each instance's files are known (and quoted) before copying
+	var remoteFiles [][]string
+	if *opts.IsPull {
+		for _, instance := range selected {
+			files, err := expandRemote(cfg, env, instance, srcFiles)
+			if err != nil {
+				return err
+			}
+			if isChunked && len(files) > 1 {
+				return fmt.Errorf("`--chunked` and `--resume` are for a single file, but %s matches %d", srcFiles[0], len(files))
+			}
+			remoteFiles = append(remoteFiles, files)
+		}
+		if err = ApprovePull(cfg, env, selected, srcFiles, target, *opts.IsConfirmed); err != nil {
+			return err
+		}
+	}
+
+	if !*opts.IsPull {
+		action := fmt.Sprintf("push %s to %s", strings.Join(srcFiles, ", "), target)
+		if len(selected) > 1 {
+			action += fmt.Sprintf(" on %d instances", len(selected))
+		}
+		if err = confirm.Environment(env, action, opts.AssumeYes != nil && *opts.AssumeYes); err != nil {
+			return err
+		}
+	}
+
+	sigs := cli.CatchSignals()
+	defer sigs.Stop()
+
+	if isChunked {
+		if *opts.IsPull {
+			return pullChunked(cfg, env, selected[0], remoteFiles[0][0], target, chunkSize, isResume, os.Stderr)
+		}
+		return pushChunked(cfg, env, selected[0], localFiles[0], target, chunkSize, isResume, os.Stderr)
+	}
+	if len(selected) == 1 && compression != "" {
+		result, err := pullCompressed(cfg, env, selected[0], remoteFiles[0], target, compression, os.Stderr, os.Stderr)
+		if result.Files > 0 {
+			out.Highlight(lvl, "pulled %s file(s): %s (%s %s) in %s", result.Files, formatBytes(result.Extracted), formatBytes(result.Received), compression, result.Elapsed.Round(time.Millisecond))
+		}
+		return err
+	}
+	if len(selected) == 1 {
+		var files []string
+		if *opts.IsPull {
+			files = remoteFiles[0]
+		}
+		if backend == BACKEND_SFTP {
+			if !*opts.IsPull {
+				files = localFiles
 			}
+			_, err = copySFTP(cfg, env, selected[0], *opts.IsPull, *opts.IsRecursing, files, target, os.Stderr)
+			return err
 		}
+		cmdArgs, profile := getArgs(cfg, env, selected[0], flags, *opts.IsPull, files, localFiles, target)
+		if profile != "" {
+			os.Setenv("AWS_PROFILE", profile)
+		}
+		return execCommand(sigs, ansibleDir, cmdArgs...)
 	}
+	return launchConcurrently(cfg, env, selected, sigs, flags, opts, compression, backend, remoteFiles, localFiles, target)
+}
+
+// declareNotSensitive asks for the legal declaration needed (by the policy) before pulling files
+func declareNotSensitive() error {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprint(out.Writer(), "Legal declaration: I confirm that I am NOT copying sensitive files (yes/no): ")
+		yorn, err := reader.ReadString('\n')
+		if yorn == "yes\n" {
+			return nil
+		} else if yorn == "no\n" || err != nil {
+			return errors.New("failed to confirm legal declaration")
+		}
+	}
+}
+
+// getArgs returns the scp args to copy to/from the instance, and the AWS profile that ssh.cfg needs.
+// For pulls, `remoteFiles` are the (literal) remote paths, as matched by expandRemote
+func getArgs(cfg *config.Config, env config.Environment, instance aws.EC2Result, flags string, isPull bool, remoteFiles, localFiles []string, target string) ([]string, string) {
+	userHost, profile := ssh.GetUserHost(cfg, env, instance)
+	isSFTP := isSFTPProtocol()
+	cmdArgs := []string{flags + "F", "ssh.cfg"}
+	if isPull {
+		for _, remoteFile := range remoteFiles {
+			cmdArgs = append(cmdArgs, getRemoteArg(userHost, remoteFile, isSFTP))
+		}
+		return append(cmdArgs, target), profile
+	}
+	cmdArgs = append(cmdArgs, localFiles...)
+	return append(cmdArgs, getRemoteArg(userHost, target, isSFTP)), profile
+}
+
+// launchConcurrently copies to/from all the instances at once, pulling into a per-host dir of `target`,
+// then shows a summary
+func launchConcurrently(cfg *config.Config, env config.Environment, instances []aws.EC2Result, sigs *cli.SignalForwarder, flags string, opts Options, compression, backend string, remoteFiles [][]string, localFiles []string, target string) error {
+	var pushBytes int64
+	for _, file := range localFiles {
+		pushBytes += getSize(file)
+	}
+
+	results := make([]hostResult, len(instances))
+	seenDirs := make(map[string]bool)
+	for i, instance := range instances {
+		results[i].instance = instance
+		if *opts.IsPull {
+			results[i].srcFiles = remoteFiles[i]
+			dir := getHostDir(instance)
+			if seenDirs[dir] {
+				dir += "-" + instance.InstanceId
+			}
+			seenDirs[dir] = true
+			results[i].dir = filepath.Join(target, dir)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(r *hostResult) {
+			defer wg.Done()
+			hostTarget := target
+			if *opts.IsPull {
+				if r.err = os.MkdirAll(r.dir, 0755); r.err != nil {
+					return
+				}
+				hostTarget = r.dir
+			}
+			if compression != "" {
+				var stderr bytes.Buffer
+				var result compressedPull
+				result, r.err = pullCompressed(cfg, env, r.instance, r.srcFiles, hostTarget, compression, nil, &stderr)
+				r.stderr = strings.TrimSpace(stderr.String())
+				r.bytes = result.Extracted
+				return
+			}
+			if backend == BACKEND_SFTP {
+				files := localFiles
+				if *opts.IsPull {
+					files = r.srcFiles
+				}
+				r.bytes, r.err = copySFTP(cfg, env, r.instance, *opts.IsPull, *opts.IsRecursing, files, hostTarget, nil)
+				return
+			}
+			// the files pulled may replace some already in the per-host dir, so they are counted on the instance
+			var pullBytes int64
+			if *opts.IsPull {
+				if pullBytes, r.err = getRemoteSize(cfg, env, r.instance, r.srcFiles); r.err != nil {
+					return
+				}
+			}
+			cmdArgs, profile := getArgs(cfg, env, r.instance, flags, *opts.IsPull, r.srcFiles, localFiles, hostTarget)
 
-	return execCommand(ansibleDir, "scp", cmdArgs...)
+			var stderr bytes.Buffer
+			c := sigs.Command("scp", cmdArgs...)
+			c.Dir = cfg.GetAnsibleDirectory(env)
+			c.Env = os.Environ()
+			if profile != "" {
+				c.Env = append(c.Env, "AWS_PROFILE="+profile)
+			}
+			c.Stdout, c.Stderr = &stderr, &stderr
+			r.err = c.Run()
+			r.stderr = strings.TrimSpace(stderr.String())
+
+			if r.err == nil {
+				r.bytes = pushBytes
+				if *opts.IsPull {
+					r.bytes = pullBytes
+				}
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+
+	return summarise(env, results, *opts.IsPull)
+}
+
+// summarise shows the outcome for each host, and returns an error if any failed
+func summarise(env config.Environment, results []hostResult, isPull bool) error {
+	lvl := out.GetLevel(env)
+	failures, total := 0, int64(0)
+	for _, r := range results {
+		name := fmt.Sprintf("%s (%s)", strings.Join(r.instance.GroupAKA, ", "), r.instance.InstanceId)
+		if r.err != nil {
+			failures++
+			out.ErrorFHighlight("%s: failed: %s", name, r.err)
+			if r.stderr != "" {
+				fmt.Println("    " + strings.ReplaceAll(r.stderr, "\n", "\n    "))
+			}
+			continue
+		}
+		total += r.bytes
+		if isPull {
+			out.Highlight(lvl, "%s: %s -> %s", name, formatBytes(r.bytes), r.dir)
+		} else {
+			out.Highlight(lvl, "%s: %s", name, formatBytes(r.bytes))
+		}
+	}
+	out.Highlight(lvl, "copied %s to/from %s of %s instances", formatBytes(total), len(results)-failures, len(results))
+	if failures > 0 {
+		return fmt.Errorf("scp failed on %d of %d instances", failures, len(results))
+	}
+	return nil
+}
+
+// getSize returns the total size of the files at `path` (recursing into dirs)
+func getSize(path string) (size int64) {
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// getRemoteSize returns the total size of the files at the (literal) remote `paths`, recursing into dirs
+func getRemoteSize(cfg *config.Config, env config.Environment, instance aws.EC2Result, paths []string) (size int64, err error) {
+	patterns := make([]string, len(paths))
+	for i, p := range paths {
+		patterns[i] = EscapeGlob(p)
+	}
+	files, err := listRemoteFiles(cfg, env, instance, patterns)
+	if err != nil {
+		return 0, err
+	}
+	for _, file := range files {
+		size += file.Size
+	}
+	return size, nil
+}
+
+// formatBytes returns `n` in (binary) units, e.g. 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
 }
 
-func execCommand(wrkDir, command string, arg ...string) error {
-	c := exec.Command(command, arg...)
+func execCommand(sigs *cli.SignalForwarder, wrkDir string, arg ...string) error {
+	c := sigs.Command("scp", arg...)
 	c.Stderr = os.Stderr
 	c.Stdin = os.Stdin
 	c.Stdout = os.Stdout
@@ -1,10 +1,26 @@
 package scp
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/clipboard"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/ssh/sshtest"
+	"github.com/fatih/color"
+	"github.com/pkg/sftp"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -49,3 +65,887 @@ func TestWithCWD(t *testing.T) {
 		})
 	})
 }
+
+func TestGetInstanceRange(t *testing.T) {
+	Convey("Given a group of four instances", t, func() {
+		isAll := false
+		to := -1
+		opts := Options{InstanceNumMax: &to, IsAll: &isAll}
+
+		Convey("When no range is given, then only the instance should be used", func() {
+			first, last, err := getInstanceRange(1, 4, opts)
+			So(err, ShouldBeNil)
+			So([]int{first, last}, ShouldResemble, []int{1, 1})
+		})
+
+		Convey("When `--to 3` is given, then the instances up to 3 should be used", func() {
+			to = 3
+			first, last, err := getInstanceRange(1, 4, opts)
+			So(err, ShouldBeNil)
+			So([]int{first, last}, ShouldResemble, []int{1, 2})
+		})
+
+		Convey("When `--to 0` is given, then the instances up to the highest should be used", func() {
+			to = 0
+			first, last, err := getInstanceRange(1, 4, opts)
+			So(err, ShouldBeNil)
+			So([]int{first, last}, ShouldResemble, []int{1, 3})
+		})
+
+		Convey("When `--all` is given, then all instances should be used", func() {
+			isAll = true
+			first, last, err := getInstanceRange(2, 4, opts)
+			So(err, ShouldBeNil)
+			So([]int{first, last}, ShouldResemble, []int{0, 3})
+		})
+
+		Convey("When the range is beyond the group or backwards, then it should fail", func() {
+			to = 5
+			_, _, err := getInstanceRange(1, 4, opts)
+			So(err, ShouldNotBeNil)
+
+			to = 1
+			_, _, err = getInstanceRange(2, 4, opts)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestGetHostDir(t *testing.T) {
+	Convey("The per-host dir should be named from the instance's first AKA, else its id", t, func() {
+		So(getHostDir(aws.EC2Result{InstanceId: "i-1", GroupAKA: []string{"publishing 2", "publishing_mount 1"}}), ShouldEqual, "publishing-2")
+		So(getHostDir(aws.EC2Result{InstanceId: "i-1"}), ShouldEqual, "i-1")
+	})
+}
+
+func TestFormatBytes(t *testing.T) {
+	Convey("Byte counts should be shown in binary units", t, func() {
+		So(formatBytes(0), ShouldEqual, "0 B")
+		So(formatBytes(1023), ShouldEqual, "1023 B")
+		So(formatBytes(1536), ShouldEqual, "1.5 KiB")
+		So(formatBytes(3*1024*1024), ShouldEqual, "3.0 MiB")
+	})
+}
+
+func TestLaunchMultiplePull(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the fake ssh runs the remote commands locally")
+	}
+	Convey("Given a pull from three instances, one of which fails", t, func() {
+		target, remote := t.TempDir(), t.TempDir()
+		So(os.WriteFile(filepath.Join(remote, "app.log"), []byte("hello"), 0644), ShouldBeNil)
+		// the fake ssh expands the patterns locally
+		cfg := sshtest.UseFakeSSH(t)
+		// a fake scp which writes a 5-byte file into its target dir, failing on i-3
+		sshtest.AddCommand(t, "scp", "#!/bin/sh\ncase \"$*\" in *i-3*) echo 'no such file' >&2; exit 1;; esac\n"+
+			"for last; do :; done\nprintf hello > \"$last/app.log\"\n")
+		env := config.Environment{Name: "sandbox"}
+		instances := []aws.EC2Result{
+			{InstanceId: "i-1", GroupAKA: []string{"web 1"}},
+			{InstanceId: "i-2", GroupAKA: []string{"web 2"}},
+			{InstanceId: "i-3", GroupAKA: []string{"web 3"}},
+		}
+		isPull, isRecursing, isConfirmed, isAll, verbosity := true, false, true, true, 0
+		opts := Options{IsPull: &isPull, IsRecursing: &isRecursing, IsConfirmed: &isConfirmed, IsAll: &isAll, Verbosity: &verbosity}
+
+		Convey("When all instances are pulled from", func() {
+			err := Launch(cfg, env, instances, 0, opts, []string{filepath.Join(remote, "*.log")}, target)
+
+			Convey("Then each host's files should be in its own dir, and the failure reported", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "1 of 3")
+				for _, dir := range []string{"web-1", "web-2"} {
+					b, err := os.ReadFile(filepath.Join(target, dir, "app.log"))
+					So(err, ShouldBeNil)
+					So(string(b), ShouldEqual, "hello")
+				}
+				So(getSize(filepath.Join(target, "web-3")), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When a host's dir already holds an earlier (larger) pull", func() {
+			So(os.MkdirAll(filepath.Join(target, "web-1"), 0755), ShouldBeNil)
+			So(os.WriteFile(filepath.Join(target, "web-1", "app.log"), []byte(strings.Repeat("x", 100)), 0644), ShouldBeNil)
+			So(os.WriteFile(filepath.Join(target, "web-1", "old.log"), []byte(strings.Repeat("x", 100)), 0644), ShouldBeNil)
+			// the summary is written to stdout
+			stdout, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+			So(err, ShouldBeNil)
+			realStdout, colorOutput := os.Stdout, color.Output
+			os.Stdout, color.Output = stdout, stdout
+			Launch(cfg, env, instances, 0, opts, []string{filepath.Join(remote, "*.log")}, target)
+			os.Stdout, color.Output = realStdout, colorOutput
+			stdout.Close()
+			summary, err := os.ReadFile(stdout.Name())
+			So(err, ShouldBeNil)
+
+			Convey("Then only the bytes copied should be reported", func() {
+				So(string(summary), ShouldContainSubstring, "web 1 (i-1): 5 B")
+				So(string(summary), ShouldContainSubstring, "copied 10 B to/from 2 of 3 instances")
+			})
+		})
+	})
+}
+
+func TestGetSyncArgs(t *testing.T) {
+	Convey("Given the sync options", t, func() {
+		isPull, isChecksum, isDeleting, isDryRun, verbosity := false, false, false, false, 0
+		excludes := []string{}
+		opts := SyncOptions{IsPull: &isPull, IsChecksum: &isChecksum, IsDeleting: &isDeleting, IsDryRun: &isDryRun, Excludes: &excludes, Verbosity: &verbosity}
+
+		Convey("When pushing, then the contents of the local dir should be synced into the remote dir using ssh.cfg", func() {
+			args := getSyncArgs(opts, "ubuntu@i-1", "/tmp/site", "site")
+			So(args, ShouldResemble, []string{"--archive", "--compress", "--itemize-changes", "--human-readable", "--rsh", "ssh -F ssh.cfg", "/tmp/site/", "ubuntu@i-1:site"})
+		})
+
+		Convey("When pulling, then the contents of the remote dir should be synced into the local dir", func() {
+			isPull = true
+			args := getSyncArgs(opts, "ubuntu@i-1", "/tmp/site", "site/")
+			So(args[len(args)-2:], ShouldResemble, []string{"ubuntu@i-1:site/", "/tmp/site"})
+		})
+
+		Convey("When checksums, deletion, a dry run and excludes are wanted, then rsync should be told", func() {
+			isChecksum, isDeleting, isDryRun = true, true, true
+			excludes = []string{"*.log", ".git/"}
+			args := getSyncArgs(opts, "ubuntu@i-1", "/tmp/site", "site")
+			So(args, ShouldContain, "--checksum")
+			So(args, ShouldContain, "--delete")
+			So(args, ShouldContain, "--dry-run")
+			So(strings.Join(args, " "), ShouldContainSubstring, "--exclude *.log --exclude .git/")
+		})
+	})
+}
+
+func TestApprovePull(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the remote file list needs GNU stat")
+	}
+	Convey("Given a secure environment, and an instance whose files are local", t, func() {
+		remote := t.TempDir()
+		cfg := sshtest.UseFakeSSH(t)
+
+		So(os.MkdirAll(filepath.Join(remote, "logs"), 0755), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(remote, "logs", "app.log"), []byte("hello"), 0644), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(remote, "logs", "server.pem"), []byte("secret"), 0644), ShouldBeNil)
+		So(os.Symlink(filepath.Join(remote, "logs", "server.pem"), filepath.Join(remote, "cert")), ShouldBeNil)
+
+		auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+		cfg.PullAuditFile = auditFile
+		env := config.Environment{Name: "prod", Tags: []string{config.TAG_SECURE}}
+		instances := []aws.EC2Result{{Name: "web 1", InstanceId: "i-1"}}
+
+		Convey("When an allowed file is pulled (declared by flag)", func() {
+			err := ApprovePull(cfg, env, instances, []string{filepath.Join(remote, "logs", "app.log")}, "/tmp", true)
+
+			Convey("Then the declaration should be audited with the file's checksum", func() {
+				So(err, ShouldBeNil)
+				b, err := os.ReadFile(auditFile)
+				So(err, ShouldBeNil)
+				var audit PullAudit
+				So(json.Unmarshal(b, &audit), ShouldBeNil)
+				So(audit.Declaration, ShouldEqual, DECLARED_BY_FLAG)
+				So(audit.InstanceID, ShouldEqual, "i-1")
+				So(audit.Files, ShouldHaveLength, 1)
+				So(audit.Files[0].Size, ShouldEqual, 5)
+				So(audit.Files[0].SHA256, ShouldEqual, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+			})
+		})
+
+		Convey("When a dir holding a denied file is pulled", func() {
+			err := ApprovePull(cfg, env, instances, []string{filepath.Join(remote, "logs")}, "/tmp", true)
+
+			Convey("Then the pull should be refused, without an audit", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "server.pem")
+				_, err = os.Stat(auditFile)
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+
+		Convey("When a symlink to a denied file is pulled", func() {
+			err := ApprovePull(cfg, env, instances, []string{filepath.Join(remote, "cert")}, "/tmp", true)
+
+			Convey("Then the pull should be refused", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "*.pem")
+			})
+		})
+
+		Convey("When the pull is larger than the policy allows", func() {
+			env.Policy = &config.Policy{PullMaxSize: "4B"}
+			err := ApprovePull(cfg, env, instances, []string{filepath.Join(remote, "logs", "app.log")}, "/tmp", true)
+
+			Convey("Then the pull should be refused", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "pull-max-size")
+			})
+		})
+
+		Convey("When a dir holding a denied file is synced, excluding it", func() {
+			err := approvePull(cfg, env, instances, []string{filepath.Join(remote, "logs")}, []string{"*.pem"}, "/tmp", true)
+
+			Convey("Then only the other files should be checked and audited", func() {
+				So(err, ShouldBeNil)
+				b, err := os.ReadFile(auditFile)
+				So(err, ShouldBeNil)
+				var audit PullAudit
+				So(json.Unmarshal(b, &audit), ShouldBeNil)
+				So(audit.Files, ShouldHaveLength, 1)
+				So(audit.Files[0].Path, ShouldEndWith, "app.log")
+				So(audit.Files[0].SHA256, ShouldEqual, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+			})
+		})
+
+		Convey("When a missing file is pulled", func() {
+			err := ApprovePull(cfg, env, instances, []string{filepath.Join(remote, "nope")}, "/tmp", true)
+
+			Convey("Then the pull should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "no such file")
+			})
+		})
+	})
+}
+
+func TestIsExcluded(t *testing.T) {
+	Convey("Files should be excluded as rsync would", t, func() {
+		So(isExcluded("app.log", []string{"*.log"}), ShouldBeTrue)
+		So(isExcluded("logs/app.log", []string{"*.log"}), ShouldBeTrue)
+		So(isExcluded("logs/app.log", []string{"logs"}), ShouldBeTrue)
+		So(isExcluded("logs/app.log", []string{"logs/"}), ShouldBeTrue)
+		So(isExcluded("logs", []string{"logs/"}), ShouldBeFalse)
+		So(isExcluded("a/logs/app.log", []string{"/logs"}), ShouldBeFalse)
+		So(isExcluded("logs/app.log", []string{"/logs"}), ShouldBeTrue)
+		So(isExcluded("a/logs/app.log", []string{"logs/*.log"}), ShouldBeTrue)
+		So(isExcluded("a/b/c.txt", []string{"a/**"}), ShouldBeTrue)
+		So(isExcluded("app.txt", []string{"*.log", ".git/"}), ShouldBeFalse)
+		So(isExcluded("app.log", nil), ShouldBeFalse)
+	})
+}
+
+func TestPullCompressed(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the remote command needs GNU tar")
+	}
+	Convey("Given an instance whose files are local", t, func() {
+		remote, target := t.TempDir(), t.TempDir()
+		cfg := sshtest.UseFakeSSH(t)
+
+		So(os.MkdirAll(filepath.Join(remote, "logs", "old"), 0755), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(remote, "logs", "app.log"), []byte("hello"), 0640), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(remote, "logs", "old", "app.1.log"), []byte(strings.Repeat("old ", 1000)), 0644), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(remote, "dump.json"), []byte("{}"), 0644), ShouldBeNil)
+
+		env := config.Environment{Name: "sandbox"}
+		instance := aws.EC2Result{InstanceId: "i-1"}
+		srcFiles := []string{filepath.Join(remote, "logs"), filepath.Join(remote, "dump.json")}
+
+		for _, compression := range []string{COMPRESS_GZIP, COMPRESS_ZSTD} {
+			if _, err := exec.LookPath(compression); err != nil {
+				continue
+			}
+			Convey("When the files are pulled with "+compression, func() {
+				result, err := pullCompressed(cfg, env, instance, srcFiles, target, compression, nil, io.Discard)
+
+				Convey("Then they should be unpacked into the target, and verified", func() {
+					So(err, ShouldBeNil)
+					So(result.Files, ShouldEqual, 3)
+					So(result.Extracted, ShouldEqual, 4007)
+					b, err := os.ReadFile(filepath.Join(target, "logs", "app.log"))
+					So(err, ShouldBeNil)
+					So(string(b), ShouldEqual, "hello")
+					info, err := os.Stat(filepath.Join(target, "logs", "app.log"))
+					So(err, ShouldBeNil)
+					So(info.Mode().Perm(), ShouldEqual, os.FileMode(0640))
+					So(getSize(filepath.Join(target, "logs", "old")), ShouldEqual, 4000)
+					So(getSize(filepath.Join(target, "dump.json")), ShouldEqual, 2)
+				})
+			})
+		}
+
+		Convey("When a missing file is pulled", func() {
+			_, err := pullCompressed(cfg, env, instance, []string{filepath.Join(remote, "nope")}, target, COMPRESS_GZIP, nil, io.Discard)
+
+			Convey("Then the pull should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestVerifySums(t *testing.T) {
+	Convey("Local checksums should be verified against the remote ones", t, func() {
+		remote := map[string]string{"a": "1", "b": "2"}
+		So(verifySums(remote, map[string]string{"a": "1", "b": "2"}), ShouldBeNil)
+
+		err := verifySums(remote, map[string]string{"a": "1", "b": "3"})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "1 of 2")
+
+		err = verifySums(remote, map[string]string{"a": "1"})
+		So(err, ShouldNotBeNil)
+
+		So(verifySums(map[string]string{}, map[string]string{"a": "1"}), ShouldNotBeNil)
+	})
+}
+
+func TestExtractUnsafe(t *testing.T) {
+	Convey("A tar with a path outside the target should not be unpacked", t, func() {
+		var buf bytes.Buffer
+		gzw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gzw)
+		So(tw.WriteHeader(&tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 1}), ShouldBeNil)
+		_, err := tw.Write([]byte("x"))
+		So(err, ShouldBeNil)
+		So(tw.Close(), ShouldBeNil)
+		So(gzw.Close(), ShouldBeNil)
+
+		target := filepath.Join(t.TempDir(), "target")
+		_, _, err = extract(&buf, target, COMPRESS_GZIP)
+		So(err, ShouldNotBeNil)
+		_, err = os.Stat(filepath.Join(filepath.Dir(target), "evil"))
+		So(os.IsNotExist(err), ShouldBeTrue)
+	})
+}
+
+func TestChunkedTransfers(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the remote commands need GNU coreutils")
+	}
+	Convey("Given an instance whose files are local, and a connection which drops", t, func() {
+		remote, local := t.TempDir(), t.TempDir()
+		runs := filepath.Join(t.TempDir(), "runs")
+		// a fake ssh which runs the remote command locally, failing on run $FAIL_ON
+		cfg := sshtest.UseSSHScript(t, "#!/bin/sh\nn=$(($(cat "+runs+" 2>/dev/null || echo 0) + 1)); echo $n > "+runs+"\n"+
+			"[ \"$n\" = \"$FAIL_ON\" ] && { echo 'connection lost' >&2; exit 255; }\nfor last; do :; done\nexec sh -c \"$last\"\n")
+		countRuns := func() string {
+			b, _ := os.ReadFile(runs)
+			os.Remove(runs)
+			return strings.TrimSpace(string(b))
+		}
+
+		cfg.RuntimeDir, cfg.TransfersDir = t.TempDir(), t.TempDir()
+		env := config.Environment{Name: "sandbox"}
+		instance := aws.EC2Result{InstanceId: "i-1"}
+		content := "0123456789"
+
+		Convey("When a push of 3 chunks is interrupted, then resumed", func() {
+			src := filepath.Join(local, "dump.sql")
+			So(os.WriteFile(src, []byte(content), 0640), ShouldBeNil)
+
+			t.Setenv("FAIL_ON", "3") // prepare, chunk 1, chunk 2 (fails)
+			err := pushChunked(cfg, env, instance, src, remote, 4, false, io.Discard)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--resume")
+			So(countRuns(), ShouldEqual, "3")
+
+			t.Setenv("FAIL_ON", "")
+			err = pushChunked(cfg, env, instance, src, remote, 4, true, io.Discard)
+
+			Convey("Then only the missing chunks should be sent, and the file joined and verified", func() {
+				So(err, ShouldBeNil)
+				So(countRuns(), ShouldEqual, "4") // prepare, chunks 2 and 3, join
+				b, err := os.ReadFile(filepath.Join(remote, "dump.sql"))
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, content)
+				info, err := os.Stat(filepath.Join(remote, "dump.sql"))
+				So(err, ShouldBeNil)
+				So(info.Mode().Perm(), ShouldEqual, os.FileMode(0640))
+				_, err = os.Stat(filepath.Join(remote, "dump.sql"+stagingSuffix))
+				So(os.IsNotExist(err), ShouldBeTrue)
+				entries, _ := os.ReadDir(cfg.TransfersDir)
+				So(entries, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a push targets a dir which does not exist", func() {
+			src := filepath.Join(local, "dump.sql")
+			So(os.WriteFile(src, []byte(content), 0640), ShouldBeNil)
+			err := pushChunked(cfg, env, instance, src, filepath.Join(remote, "missing", "dump.sql"), 4, false, io.Discard)
+
+			Convey("Then it should fail before sending any chunks, without creating the dir", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "no such directory: "+filepath.Join(remote, "missing"))
+				So(countRuns(), ShouldEqual, "1")
+				_, err = os.Stat(filepath.Join(remote, "missing"))
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+
+		Convey("When a pull of 3 chunks is interrupted, then resumed", func() {
+			src := filepath.Join(remote, "dump.sql")
+			So(os.WriteFile(src, []byte(content), 0600), ShouldBeNil)
+
+			t.Setenv("FAIL_ON", "4") // stat, checksums, chunk 1, chunk 2 (fails)
+			err := pullChunked(cfg, env, instance, src, local, 4, false, io.Discard)
+			So(err, ShouldNotBeNil)
+			So(countRuns(), ShouldEqual, "4")
+
+			t.Setenv("FAIL_ON", "")
+			err = pullChunked(cfg, env, instance, src, local, 4, true, io.Discard)
+
+			Convey("Then only the missing chunks should be pulled, and the file joined and verified", func() {
+				So(err, ShouldBeNil)
+				So(countRuns(), ShouldEqual, "3") // stat, chunks 2 and 3
+				b, err := os.ReadFile(filepath.Join(local, "dump.sql"))
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, content)
+				_, err = os.Stat(filepath.Join(local, "dump.sql"+stagingSuffix))
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the remote file changes before a pull is resumed", func() {
+			src := filepath.Join(remote, "dump.sql")
+			So(os.WriteFile(src, []byte(content), 0600), ShouldBeNil)
+			t.Setenv("FAIL_ON", "4")
+			So(pullChunked(cfg, env, instance, src, local, 4, false, io.Discard), ShouldNotBeNil)
+
+			t.Setenv("FAIL_ON", "")
+			So(os.WriteFile(src, []byte("a different dump"), 0600), ShouldBeNil)
+			So(os.Chtimes(src, time.Now().Add(time.Hour), time.Now().Add(time.Hour)), ShouldBeNil)
+			err := pullChunked(cfg, env, instance, src, local, 4, true, io.Discard)
+
+			Convey("Then the pull should start again, and get the new file", func() {
+				So(err, ShouldBeNil)
+				b, err := os.ReadFile(filepath.Join(local, "dump.sql"))
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "a different dump")
+			})
+		})
+	})
+}
+
+func TestGetSums(t *testing.T) {
+	Convey("The checksums of each chunk, and of the whole, should be returned", t, func() {
+		sum, chunks, err := getSums(strings.NewReader("01234567"), 4)
+		So(err, ShouldBeNil)
+		So(chunks, ShouldHaveLength, 2)
+		whole, _, _ := getSums(strings.NewReader("01234567"), 100)
+		So(sum, ShouldEqual, whole)
+
+		_, chunks, err = getSums(strings.NewReader(""), 4)
+		So(err, ShouldBeNil)
+		So(chunks, ShouldBeEmpty)
+	})
+}
+
+func TestQuotePattern(t *testing.T) {
+	Convey("Patterns should be quoted so that only their glob characters are special", t, func() {
+		for _, tc := range []struct{ pattern, want string }{
+			{"app.log", "app.log"},
+			{"~/logs/app.log", "logs/app.log"},
+			{"/var/log/my app/*.log", "'/var/log/my app/'*.log"},
+			{"it's?.log", `'it'\''s'?.log`},
+			{"$(reboot)*", "'$(reboot)'*"},
+			{"app.[0-9].log", "app.[0-9].log"},
+			{"[ x]", "[' 'x]"},
+			{`\*.log`, "'*.log'"},
+			{"[unclosed", "'[unclosed'"},
+			{"", "''"},
+		} {
+			So(QuotePattern(tc.pattern), ShouldEqual, tc.want)
+		}
+	})
+}
+
+func TestQuotePatternExpansion(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the patterns are expanded by the local sh")
+	}
+	Convey("Given files with awkward names", t, func() {
+		dir := t.TempDir()
+		for _, name := range []string{"my app.log", "it's.log", `say "hi".log`, "a.1.log", "a.2.log", "*.log", "$HOME", "x.txt"} {
+			So(os.WriteFile(filepath.Join(dir, name), nil, 0644), ShouldBeNil)
+		}
+
+		for _, tc := range []struct {
+			pattern string
+			want    []string
+		}{
+			{"my app.log", []string{"my app.log"}},
+			{"my *", []string{"my app.log"}},
+			{"it's.log", []string{"it's.log"}},
+			{`say "*`, []string{`say "hi".log`}},
+			{"a.?.log", []string{"a.1.log", "a.2.log"}},
+			{"a.[!1].log", []string{"a.2.log"}},
+			{`\*.log`, []string{"*.log"}},
+			{"$HOME", []string{"$HOME"}},
+			{"*.txt", []string{"x.txt"}},
+		} {
+			Convey("When "+tc.pattern+" is expanded by the shell, then it should match "+strings.Join(tc.want, ", "), func() {
+				c := exec.Command("sh", "-c", "set -- "+QuotePattern(tc.pattern)+`; printf '%s\n' "$@"`)
+				c.Dir = dir
+				output, err := c.Output()
+				So(err, ShouldBeNil)
+				So(strings.Split(strings.TrimSuffix(string(output), "\n"), "\n"), ShouldResemble, tc.want)
+			})
+		}
+	})
+}
+
+func TestGetRemoteArg(t *testing.T) {
+	Convey("Remote paths should be quoted for the scp protocol", t, func() {
+		for _, tc := range []struct {
+			path   string
+			isSFTP bool
+			want   string
+		}{
+			{"/var/log/app.log", false, "u@h:/var/log/app.log"},
+			{"/var/log/my app.log", false, "u@h:'/var/log/my app.log'"},
+			{"it's [1].log", false, `u@h:'it'\''s [1].log'`},
+			{"/var/log/my app.log", true, "u@h:/var/log/my app.log"},
+			{"it's [1]*.log", true, `u@h:it's \[1\]\*.log`},
+			{"~/backup", true, "u@h:backup"},
+		} {
+			So(getRemoteArg("u@h", tc.path, tc.isSFTP), ShouldEqual, tc.want)
+		}
+	})
+
+	Convey("scp should use SFTP from OpenSSH 9.0", t, func() {
+		So(usesSFTP("OpenSSH_8.9p1 Ubuntu-3ubuntu0.10, OpenSSL 3.0.2 15 Mar 2022"), ShouldBeFalse)
+		So(usesSFTP("OpenSSH_9.2p1 Debian-2+deb12u7, OpenSSL 3.0.17 1 Jul 2025"), ShouldBeTrue)
+		So(usesSFTP("OpenSSH_10.0p2, LibreSSL 3.3.6"), ShouldBeTrue)
+		So(usesSFTP(""), ShouldBeTrue)
+	})
+}
+
+func TestExpandRemote(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the fake ssh runs the remote commands locally")
+	}
+	Convey("Given an instance whose files are local", t, func() {
+		remote := t.TempDir()
+		cfg := sshtest.UseFakeSSH(t)
+		for _, name := range []string{"a 1.log", "a 2.log", "b.txt"} {
+			So(os.WriteFile(filepath.Join(remote, name), nil, 0644), ShouldBeNil)
+		}
+
+		env := config.Environment{Name: "sandbox"}
+		instance := aws.EC2Result{InstanceId: "i-1", GroupAKA: []string{"web 1"}}
+
+		Convey("When the patterns all match, then their matches should be returned in order", func() {
+			files, err := expandRemote(cfg, env, instance, []string{filepath.Join(remote, "b.*"), filepath.Join(remote, "a *.log")})
+			So(err, ShouldBeNil)
+			So(files, ShouldResemble, []string{filepath.Join(remote, "b.txt"), filepath.Join(remote, "a 1.log"), filepath.Join(remote, "a 2.log")})
+		})
+
+		Convey("When a pattern matches nothing, then it should be named in the error", func() {
+			_, err := expandRemote(cfg, env, instance, []string{filepath.Join(remote, "b.txt"), filepath.Join(remote, "*.gz"), filepath.Join(remote, "c d")})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "no match on web 1 (i-1) for: "+filepath.Join(remote, "*.gz")+", "+filepath.Join(remote, "c d"))
+		})
+	})
+}
+
+// newTestSFTPClient returns a client of an in-process SFTP server (of the local file system)
+func newTestSFTPClient(t *testing.T) *sftp.Client {
+	toServer, fromClient := io.Pipe()
+	toClient, fromServer := io.Pipe()
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{toServer, fromServer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	client, err := sftp.NewClientPipe(toClient, fromClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the server is closed first, which ends the client's reads (else closing the client waits for them)
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return client
+}
+
+func TestSFTPTransfer(t *testing.T) {
+	Convey("Given an SFTP session and some files", t, func() {
+		local, remote := t.TempDir(), t.TempDir()
+		mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		for _, dir := range []string{local, remote} {
+			So(os.MkdirAll(filepath.Join(dir, "logs", "old"), 0755), ShouldBeNil)
+			So(os.WriteFile(filepath.Join(dir, "logs", "app.log"), []byte("hello"), 0640), ShouldBeNil)
+			So(os.WriteFile(filepath.Join(dir, "logs", "old", "app.1.log"), []byte("old"), 0600), ShouldBeNil)
+			So(os.Chtimes(filepath.Join(dir, "logs", "app.log"), mtime, mtime), ShouldBeNil)
+		}
+		var progress bytes.Buffer
+		tr := &sftpTransfer{client: newTestSFTPClient(t), progress: &progress}
+		target := t.TempDir()
+
+		Convey("When a file is pulled, then its contents, mode and time should be copied, with a progress bar", func() {
+			So(tr.pull([]string{filepath.Join(remote, "logs", "app.log")}, target), ShouldBeNil)
+			info, err := os.Stat(filepath.Join(target, "app.log"))
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0640))
+			So(info.ModTime().Equal(mtime), ShouldBeTrue)
+			So(tr.copied, ShouldEqual, 5)
+			So(progress.String(), ShouldContainSubstring, "app.log [====================] 100% 5 B")
+		})
+
+		Convey("When a dir is pulled without -r, then it should fail", func() {
+			err := tr.pull([]string{filepath.Join(remote, "logs")}, target)
+			var transferErr *TransferError
+			So(errors.As(err, &transferErr), ShouldBeTrue)
+			So(transferErr.Path, ShouldEqual, filepath.Join(remote, "logs"))
+		})
+
+		Convey("When a dir is pulled with -r, then all its files should be copied", func() {
+			tr.isRecursing = true
+			So(tr.pull([]string{filepath.Join(remote, "logs")}, target), ShouldBeNil)
+			b, err := os.ReadFile(filepath.Join(target, "logs", "old", "app.1.log"))
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "old")
+			So(tr.copied, ShouldEqual, 8)
+		})
+
+		Convey("When files are pushed into a remote dir, then they should be copied there", func() {
+			remoteTarget := filepath.Join(remote, "in")
+			So(os.Mkdir(remoteTarget, 0755), ShouldBeNil)
+			So(tr.push([]string{filepath.Join(local, "logs", "app.log"), filepath.Join(local, "logs", "old", "app.1.log")}, remoteTarget), ShouldBeNil)
+			info, err := os.Stat(filepath.Join(remoteTarget, "app.log"))
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0640))
+			So(info.ModTime().Equal(mtime), ShouldBeTrue)
+			b, err := os.ReadFile(filepath.Join(remoteTarget, "app.1.log"))
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "old")
+		})
+
+		Convey("When several files are pushed to a remote file, then it should fail", func() {
+			err := tr.push([]string{filepath.Join(local, "logs", "app.log"), filepath.Join(local, "logs", "old", "app.1.log")}, filepath.Join(remote, "new.log"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When a missing file is pulled, then the error should say so", func() {
+			err := tr.pull([]string{filepath.Join(remote, "nope.log")}, target)
+			So(errors.Is(err, os.ErrNotExist), ShouldBeTrue)
+			So(err.Error(), ShouldStartWith, "stat "+filepath.Join(remote, "nope.log"))
+		})
+	})
+}
+
+func TestGetBackend(t *testing.T) {
+	Convey("The backend should be the flag's, else the config's, else scp", t, func() {
+		cfg := &config.Config{}
+		backend, err := getBackend(cfg, Options{})
+		So(err, ShouldBeNil)
+		So(backend, ShouldEqual, BACKEND_SCP)
+
+		cfg.SCPBackend = BACKEND_SFTP
+		backend, err = getBackend(cfg, Options{})
+		So(err, ShouldBeNil)
+		So(backend, ShouldEqual, BACKEND_SFTP)
+
+		flag := BACKEND_SCP
+		backend, err = getBackend(cfg, Options{Backend: &flag})
+		So(err, ShouldBeNil)
+		So(backend, ShouldEqual, BACKEND_SCP)
+
+		flag = "rsync"
+		_, err = getBackend(cfg, Options{Backend: &flag})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestFormatBar(t *testing.T) {
+	Convey("The progress bar should show the share of the file copied", t, func() {
+		So(formatBar("a.log", 512, 1024, time.Second), ShouldEqual, "a.log [==========          ]  50% 512 B (512 B/s)   ")
+		So(formatBar("empty", 0, 0, 0), ShouldStartWith, "empty [====================] 100%")
+	})
+}
+
+func TestCopyBetween(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the fake ssh runs the remote commands locally")
+	}
+	Convey("Given two instances whose files are local", t, func() {
+		srcDir, dstDir := t.TempDir(), t.TempDir()
+		cfg := sshtest.UseFakeSSH(t)
+
+		mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		So(os.MkdirAll(filepath.Join(srcDir, "conf", "extra"), 0755), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(srcDir, "conf", "my app.json"), []byte(`{"a":1}`), 0640), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(srcDir, "conf", "extra", "b.json"), []byte(`{}`), 0644), ShouldBeNil)
+		So(os.Chtimes(filepath.Join(srcDir, "conf", "my app.json"), mtime, mtime), ShouldBeNil)
+
+		env := config.Environment{Name: "sandbox"}
+		src := aws.EC2Result{InstanceId: "i-1", GroupAKA: []string{"web 1"}}
+		dst := aws.EC2Result{InstanceId: "i-2", GroupAKA: []string{"publishing 1"}}
+		isRecursing, isConfirmed, assumeYes := false, true, true
+		opts := Options{IsRecursing: &isRecursing, IsConfirmed: &isConfirmed, AssumeYes: &assumeYes}
+
+		Convey("When a file is copied to a new name, then it should be there with its mode and time", func() {
+			target := filepath.Join(dstDir, "app.json")
+			So(CopyBetween(cfg, env, src, []string{filepath.Join(srcDir, "conf", "my *.json")}, dst, target, opts), ShouldBeNil)
+			info, err := os.Stat(target)
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0640))
+			So(info.ModTime().Equal(mtime), ShouldBeTrue)
+			entries, err := os.ReadDir(dstDir)
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 1) // no temporary dir left
+		})
+
+		Convey("When a file is copied into a dir, then it should keep its name", func() {
+			So(CopyBetween(cfg, env, src, []string{filepath.Join(srcDir, "conf", "my app.json")}, dst, dstDir, opts), ShouldBeNil)
+			b, err := os.ReadFile(filepath.Join(dstDir, "my app.json"))
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, `{"a":1}`)
+		})
+
+		Convey("When a dir is copied without -r, then it should fail on the sender", func() {
+			err := CopyBetween(cfg, env, src, []string{filepath.Join(srcDir, "conf")}, dst, dstDir, opts)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "is a dir (use -r)")
+		})
+
+		Convey("When a dir is copied with -r, then all its files should be copied", func() {
+			isRecursing = true
+			So(CopyBetween(cfg, env, src, []string{filepath.Join(srcDir, "conf")}, dst, dstDir, opts), ShouldBeNil)
+			b, err := os.ReadFile(filepath.Join(dstDir, "conf", "extra", "b.json"))
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, `{}`)
+		})
+
+		Convey("When the target's dir is missing, then it should fail on the receiver", func() {
+			err := CopyBetween(cfg, env, src, []string{filepath.Join(srcDir, "conf", "my app.json")}, dst, filepath.Join(dstDir, "nope", "app.json"), opts)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "cannot receive on i-2")
+		})
+
+		Convey("When the source is the target, then it should fail", func() {
+			So(CopyBetween(cfg, env, src, []string{"a"}, src, "b", opts), ShouldNotBeNil)
+		})
+
+		Convey("When a direct copy is asked for in a secure environment, then the policy should refuse it", func() {
+			isDirect := true
+			opts.IsDirect = &isDirect
+			secure := config.Environment{Name: "prod", Tags: []string{config.TAG_SECURE}}
+			err := CopyBetween(cfg, secure, src, []string{filepath.Join(srcDir, "conf", "my app.json")}, dst, dstDir, opts)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "allow-direct-copy")
+			entries, err := os.ReadDir(dstDir)
+			So(err, ShouldBeNil)
+			So(entries, ShouldBeEmpty)
+		})
+
+		Convey("When a direct copy is asked for in an environment reached via SSM, then it should be refused", func() {
+			isDirect := true
+			opts.IsDirect = &isDirect
+			err := CopyBetween(cfg, env, src, []string{filepath.Join(srcDir, "conf", "my app.json")}, dst, dstDir, opts)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "ssh-target: ip")
+			entries, err := os.ReadDir(dstDir)
+			So(err, ShouldBeNil)
+			So(entries, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestGetDirectCommand(t *testing.T) {
+	Convey("A direct copy should pipe the tar into ssh to the target instance", t, func() {
+		remoteCmd := getDirectCommand("ubuntu@10.0.0.2", []string{"/tmp/a.json"}, true, "/tmp/b.json")
+		So(remoteCmd, ShouldStartWith, "tar -c -h -f - ")
+		So(remoteCmd, ShouldContainSubstring, "| ssh -o BatchMode=yes ubuntu@10.0.0.2 'd=/tmp/b.json; ")
+		So(remoteCmd, ShouldNotContainSubstring, "StrictHostKeyChecking")
+	})
+}
+
+func TestLaunchStream(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the fake ssh runs the remote commands locally")
+	}
+	Convey("Given a secure environment, and an instance whose files are local", t, func() {
+		remote := t.TempDir()
+		cfg := sshtest.UseFakeSSH(t)
+		So(os.WriteFile(filepath.Join(remote, "config.json"), []byte(`{"a":1}`), 0640), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(remote, "other.json"), nil, 0644), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(remote, "server.pem"), []byte("secret"), 0644), ShouldBeNil)
+
+		auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+		cfg.PullAuditFile = auditFile
+		env := config.Environment{Name: "prod", Tags: []string{config.TAG_SECURE}}
+		instance := aws.EC2Result{InstanceId: "i-1"}
+		isPull, isConfirmed, isClipboard, assumeYes := true, true, false, true
+		cb := clipboard.File{Path: filepath.Join(t.TempDir(), "clipboard")}
+		opts := Options{IsPull: &isPull, IsConfirmed: &isConfirmed, IsClipboard: &isClipboard, Clipboard: cb, AssumeYes: &assumeYes}
+
+		Convey("When a file is pulled to stdout, then it should be written there, and the declaration audited", func() {
+			var stdout bytes.Buffer
+			So(launchStream(cfg, env, instance, opts, []string{filepath.Join(remote, "conf*.json")}, STDIO, nil, &stdout), ShouldBeNil)
+			So(stdout.String(), ShouldEqual, `{"a":1}`)
+			b, err := os.ReadFile(auditFile)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldContainSubstring, `"target":"stdout"`)
+		})
+
+		Convey("When a file is pulled to the real stdout, then stdout should hold only the file", func() {
+			stdout, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+			So(err, ShouldBeNil)
+			realStdout, colorOutput := os.Stdout, color.Output
+			os.Stdout, color.Output = stdout, stdout
+			err = launchStream(cfg, env, instance, opts, []string{filepath.Join(remote, "config.json")}, STDIO, nil, os.Stdout)
+			os.Stdout, color.Output = realStdout, colorOutput
+			stdout.Close()
+			So(err, ShouldBeNil)
+			b, err := os.ReadFile(stdout.Name())
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, `{"a":1}`)
+		})
+
+		Convey("When several files match, then it should fail", func() {
+			err := launchStream(cfg, env, instance, opts, []string{filepath.Join(remote, "*.json")}, STDIO, nil, &bytes.Buffer{})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "matches 2")
+		})
+
+		Convey("When a denied file is pulled, then the policy should refuse it", func() {
+			var stdout bytes.Buffer
+			So(launchStream(cfg, env, instance, opts, []string{filepath.Join(remote, "server.pem")}, STDIO, nil, &stdout), ShouldNotBeNil)
+			So(stdout.Len(), ShouldEqual, 0)
+		})
+
+		Convey("When a file is pulled to the clipboard, then the clipboard should have it", func() {
+			isClipboard = true
+			So(launchStream(cfg, env, instance, opts, []string{filepath.Join(remote, "config.json")}, "", nil, nil), ShouldBeNil)
+			b, err := cb.Read()
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, `{"a":1}`)
+		})
+
+		Convey("When stdin is pushed to a new file, then it should be written", func() {
+			isPull = false
+			target := filepath.Join(remote, "new.json")
+			So(launchStream(cfg, env, instance, opts, []string{STDIO}, target, strings.NewReader(`{"b":2}`), nil), ShouldBeNil)
+			b, err := os.ReadFile(target)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, `{"b":2}`)
+			entries, err := os.ReadDir(remote)
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 4) // no temporary file left
+		})
+
+		Convey("When the clipboard is pushed to an existing file, then it should be replaced, keeping its mode", func() {
+			isPull, isClipboard = false, true
+			So(cb.Write([]byte(`{"c":3}`)), ShouldBeNil)
+			target := filepath.Join(remote, "config.json")
+			So(launchStream(cfg, env, instance, opts, nil, target, nil, nil), ShouldBeNil)
+			b, err := os.ReadFile(target)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, `{"c":3}`)
+			info, err := os.Stat(target)
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0640))
+		})
+
+		Convey("When stdin is pushed to a dir, then it should fail", func() {
+			isPull = false
+			err := launchStream(cfg, env, instance, opts, []string{STDIO}, remote, strings.NewReader("x"), nil)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "is a dir")
+		})
+	})
+}
@@ -0,0 +1,342 @@
+package scp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/ssh"
+	"github.com/pkg/sftp"
+)
+
+// backends (`scp-backend` in config, or `--backend`) which copy the files
+const (
+	BACKEND_SCP  = "scp"  // the scp command
+	BACKEND_SFTP = "sftp" // an SFTP session (over ssh.cfg)
+)
+
+// progressInterval is how often progress bars are redrawn
+const progressInterval = 200 * time.Millisecond
+
+// TransferError is the failure of an operation on a file during an SFTP copy
+type TransferError struct {
+	Op   string // e.g. "open", "write" or "chmod"
+	Path string
+	Err  error
+}
+
+func (e *TransferError) Error() string {
+	return e.Op + " " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *TransferError) Unwrap() error {
+	return e.Err
+}
+
+// getBackend returns the backend to copy with: `--backend` if given, else the config's
+func getBackend(cfg *config.Config, opts Options) (string, error) {
+	backend := cfg.GetSCPBackend()
+	if opts.Backend != nil && *opts.Backend != "" {
+		backend = *opts.Backend
+	}
+	if backend != BACKEND_SCP && backend != BACKEND_SFTP {
+		return "", fmt.Errorf("unknown backend %q (use %s or %s)", backend, BACKEND_SCP, BACKEND_SFTP)
+	}
+	return backend, nil
+}
+
+// sftpTransfer copies files over an SFTP session, preserving their modes and modification times (as `scp -p` does)
+type sftpTransfer struct {
+	client      *sftp.Client
+	isRecursing bool
+	progress    io.Writer // for progress bars, if not nil
+	copied      int64     // bytes
+}
+
+// dialSFTP starts an SFTP session on the instance (using the sftp subsystem over ssh.cfg),
+// returning the client and a func to end the session
+func dialSFTP(cfg *config.Config, env config.Environment, instance aws.EC2Result) (*sftp.Client, func() error, error) {
+	c, err := ssh.RemoteCommandWithOptions(cfg, env, instance, []string{"-s"}, "sftp")
+	if err != nil {
+		return nil, nil, err
+	}
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	if err = c.Start(); err != nil {
+		return nil, nil, err
+	}
+	client, err := sftp.NewClientPipe(stdout, stdin)
+	if err != nil {
+		stdin.Close()
+		c.Wait()
+		return nil, nil, fmt.Errorf("cannot start an SFTP session on %s: %w: %s", instance.InstanceId, err, strings.TrimSpace(stderr.String()))
+	}
+	return client, func() error {
+		client.Close()
+		return c.Wait()
+	}, nil
+}
+
+// copySFTP copies files to/from the instance over an SFTP session. For pulls, `srcFiles` are the remote paths
+// (as matched by expandRemote), else the local ones. It returns the bytes copied
+func copySFTP(cfg *config.Config, env config.Environment, instance aws.EC2Result, isPull, isRecursing bool, srcFiles []string, target string, progress io.Writer) (int64, error) {
+	client, closeSession, err := dialSFTP(cfg, env, instance)
+	if err != nil {
+		return 0, err
+	}
+	t := &sftpTransfer{client: client, isRecursing: isRecursing, progress: progress}
+	if isPull {
+		err = t.pull(srcFiles, target)
+	} else {
+		err = t.push(srcFiles, target)
+	}
+	if closeErr := closeSession(); err == nil && closeErr != nil {
+		err = fmt.Errorf("SFTP session on %s: %w", instance.InstanceId, closeErr)
+	}
+	return t.copied, err
+}
+
+// pull copies the remote files (or dirs, if recursing) into the local `target`,
+// which must be a dir if there is more than one file
+func (t *sftpTransfer) pull(remoteFiles []string, target string) error {
+	info, err := os.Stat(target)
+	isDir := err == nil && info.IsDir()
+	if len(remoteFiles) > 1 && !isDir {
+		return &TransferError{"pull into", target, errors.New("not a dir")}
+	}
+	for _, remoteFile := range remoteFiles {
+		remoteFile = trimHome(remoteFile)
+		// follow symlinks, as scp does
+		info, err := t.client.Stat(remoteFile)
+		if err != nil {
+			return &TransferError{"stat", remoteFile, err}
+		}
+		dst := target
+		if isDir {
+			dst = filepath.Join(target, path.Base(remoteFile))
+		}
+		if err = t.pullEntry(remoteFile, dst, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pullEntry copies the remote file (or dir) `src` to the local `dst`
+func (t *sftpTransfer) pullEntry(src, dst string, info fs.FileInfo) error {
+	if info.IsDir() {
+		if !t.isRecursing {
+			return &TransferError{"pull", src, errors.New("is a dir (use -r)")}
+		}
+		if err := os.MkdirAll(dst, 0700); err != nil {
+			return &TransferError{"mkdir", dst, err}
+		}
+		entries, err := t.client.ReadDir(src)
+		if err != nil {
+			return &TransferError{"read dir", src, err}
+		}
+		for _, e := range entries {
+			child := path.Join(src, e.Name())
+			if e.Mode()&fs.ModeSymlink != 0 {
+				if e, err = t.client.Stat(child); err != nil {
+					return &TransferError{"stat", child, err}
+				}
+			}
+			if err = t.pullEntry(child, filepath.Join(dst, e.Name()), e); err != nil {
+				return err
+			}
+		}
+		return preserveLocal(dst, info)
+	}
+	if !info.Mode().IsRegular() {
+		return &TransferError{"pull", src, errors.New("not a regular file")}
+	}
+
+	r, err := t.client.Open(src)
+	if err != nil {
+		return &TransferError{"open", src, err}
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return &TransferError{"create", dst, err}
+	}
+	bar := t.newBar(path.Base(src), info.Size())
+	n, err := io.Copy(io.MultiWriter(w, bar), r)
+	bar.finish()
+	t.copied += n
+	if err != nil {
+		w.Close()
+		return &TransferError{"pull", src, err}
+	}
+	if err = w.Close(); err != nil {
+		return &TransferError{"write", dst, err}
+	}
+	return preserveLocal(dst, info)
+}
+
+// preserveLocal sets the mode and modification time of the local `dst` from `info`
+func preserveLocal(dst string, info fs.FileInfo) error {
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return &TransferError{"chmod", dst, err}
+	}
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return &TransferError{"set times of", dst, err}
+	}
+	return nil
+}
+
+// push copies the local files (or dirs, if recursing) to the remote `target`,
+// which must be a dir if there is more than one file
+func (t *sftpTransfer) push(localFiles []string, target string) error {
+	target = trimHome(target)
+	info, err := t.client.Stat(target)
+	isDir := err == nil && info.IsDir()
+	if len(localFiles) > 1 && !isDir {
+		return &TransferError{"push into", target, errors.New("not a dir")}
+	}
+	for _, localFile := range localFiles {
+		info, err := os.Stat(localFile)
+		if err != nil {
+			return &TransferError{"stat", localFile, err}
+		}
+		dst := target
+		if isDir {
+			dst = path.Join(target, filepath.Base(localFile))
+		}
+		if err = t.pushEntry(localFile, dst, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushEntry copies the local file (or dir) `src` to the remote `dst`
+func (t *sftpTransfer) pushEntry(src, dst string, info fs.FileInfo) error {
+	if info.IsDir() {
+		if !t.isRecursing {
+			return &TransferError{"push", src, errors.New("is a dir (use -r)")}
+		}
+		if err := t.client.MkdirAll(dst); err != nil {
+			return &TransferError{"mkdir", dst, err}
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return &TransferError{"read dir", src, err}
+		}
+		for _, e := range entries {
+			child := filepath.Join(src, e.Name())
+			// follow symlinks, as scp does
+			childInfo, err := os.Stat(child)
+			if err != nil {
+				return &TransferError{"stat", child, err}
+			}
+			if err = t.pushEntry(child, path.Join(dst, e.Name()), childInfo); err != nil {
+				return err
+			}
+		}
+		return t.preserveRemote(dst, info)
+	}
+	if !info.Mode().IsRegular() {
+		return &TransferError{"push", src, errors.New("not a regular file")}
+	}
+
+	r, err := os.Open(src)
+	if err != nil {
+		return &TransferError{"open", src, err}
+	}
+	defer r.Close()
+	w, err := t.client.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY)
+	if err != nil {
+		return &TransferError{"create", dst, err}
+	}
+	bar := t.newBar(filepath.Base(src), info.Size())
+	n, err := io.Copy(w, io.TeeReader(r, bar))
+	bar.finish()
+	t.copied += n
+	if err != nil {
+		w.Close()
+		return &TransferError{"push", src, err}
+	}
+	if err = w.Close(); err != nil {
+		return &TransferError{"write", dst, err}
+	}
+	return t.preserveRemote(dst, info)
+}
+
+// preserveRemote sets the mode and modification time of the remote `dst` from `info`
+func (t *sftpTransfer) preserveRemote(dst string, info fs.FileInfo) error {
+	if err := t.client.Chmod(dst, info.Mode().Perm()); err != nil {
+		return &TransferError{"chmod", dst, err}
+	}
+	if err := t.client.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return &TransferError{"set times of", dst, err}
+	}
+	return nil
+}
+
+// trimHome returns the remote path `p` without a leading `~/` (relative paths are in the remote home dir)
+func trimHome(p string) string {
+	if p == "~" {
+		return "."
+	}
+	return strings.TrimPrefix(p, "~/")
+}
+
+// progressBar shows the progress of copying a file, as it is written to
+type progressBar struct {
+	w       io.Writer // nil for no bar
+	name    string
+	total   int64
+	n       int64
+	started time.Time
+	drawn   time.Time
+}
+
+func (t *sftpTransfer) newBar(name string, total int64) *progressBar {
+	return &progressBar{w: t.progress, name: name, total: total, started: time.Now()}
+}
+
+func (b *progressBar) Write(p []byte) (int, error) {
+	b.n += int64(len(p))
+	if b.w != nil && time.Since(b.drawn) >= progressInterval {
+		b.drawn = time.Now()
+		fmt.Fprint(b.w, "\r"+formatBar(b.name, b.n, b.total, time.Since(b.started)))
+	}
+	return len(p), nil
+}
+
+// finish draws the bar for the final count, and ends its line
+func (b *progressBar) finish() {
+	if b.w != nil {
+		fmt.Fprintln(b.w, "\r"+formatBar(b.name, b.n, b.total, time.Since(b.started)))
+	}
+}
+
+// formatBar returns the progress bar of `n` of `total` bytes copied (in `elapsed`) of the file `name`
+func formatBar(name string, n, total int64, elapsed time.Duration) string {
+	const width = 20
+	percent := int64(100)
+	if total > 0 {
+		percent = min(n*100/total, 100)
+	}
+	filled := int(percent * width / 100)
+	return fmt.Sprintf("%s [%s%s] %3d%% %s", name, strings.Repeat("=", filled), strings.Repeat(" ", width-filled), percent, formatProgress(n, elapsed))
+}
@@ -0,0 +1,114 @@
+package scp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/clipboard"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/confirm"
+	"github.com/ONSdigital/dp-cli/out"
+	"github.com/ONSdigital/dp-cli/remotefs"
+	"github.com/ONSdigital/dp-cli/ssh"
+)
+
+// STDIO is the src (of a push) or target (of a pull) which streams from stdin or to stdout
+const STDIO = "-"
+
+// isStreaming returns whether the copy is from stdin, to stdout, or to/from the clipboard
+func isStreaming(opts Options, srcFiles []string, target string) bool {
+	if opts.IsClipboard != nil && *opts.IsClipboard {
+		return true
+	}
+	if *opts.IsPull {
+		return target == STDIO
+	}
+	return len(srcFiles) == 1 && srcFiles[0] == STDIO
+}
+
+// getWriteCommand returns the (remote) shell command which writes stdin to the file `target`. The file is only
+// replaced once all of stdin is written, and an existing file keeps its mode
+func getWriteCommand(target string) string {
+	return "d=" + ssh.ShellQuote(trimHome(target)) + "; " +
+		`if [ -d "$d" ]; then echo "is a dir (give the file name): $d" >&2; exit 2; fi; ` +
+		`t=$(mktemp "$(dirname -- "$d")/.dp-stream.XXXXXX") || exit 2; ` +
+		`cat > "$t" && if [ -e "$d" ]; then cat -- "$t" > "$d"; else chmod "$(printf '%o' $((0666 & ~$(umask))))" "$t" && mv -f -- "$t" "$d"; fi; ` +
+		`s=$?; rm -f -- "$t"; exit $s`
+}
+
+// launchStream copies a single file between the instance and `stdin` (for pushes) or `stdout` (for pulls),
+// or with IsClipboard, the clipboard. Pulls are checked against the environment's policy, as any pull is
+func launchStream(cfg *config.Config, env config.Environment, instance aws.EC2Result, opts Options, srcFiles []string, target string, stdin io.Reader, stdout io.Writer) (err error) {
+	var cb clipboard.Clipboard
+	if opts.IsClipboard != nil && *opts.IsClipboard {
+		if cb = opts.Clipboard; cb == nil {
+			if cb, err = clipboard.New(); err != nil {
+				return err
+			}
+		}
+	}
+	lvl := out.GetLevel(env)
+
+	if *opts.IsPull {
+		targetName := "clipboard"
+		if cb == nil {
+			targetName = "stdout"
+			// stdout is the file, so messages (and any declaration) go to stderr
+			defer out.UseStderr()()
+		}
+		files, err := expandRemote(cfg, env, instance, srcFiles)
+		if err != nil {
+			return err
+		}
+		if len(files) != 1 {
+			return fmt.Errorf("can only pull a single file to %s, but %s matches %d", targetName, strings.Join(srcFiles, ", "), len(files))
+		}
+		if err = ApprovePull(cfg, env, []aws.EC2Result{instance}, srcFiles, targetName, *opts.IsConfirmed); err != nil {
+			return err
+		}
+		if cb == nil {
+			return remotefs.Cat(cfg, env, instance, files[0], stdout)
+		}
+		var buf bytes.Buffer
+		if err = remotefs.Cat(cfg, env, instance, files[0], &buf); err != nil {
+			return err
+		}
+		if err = cb.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		out.Highlight(lvl, "copied %s (%s) to the clipboard", files[0], formatBytes(int64(buf.Len())))
+		return nil
+	}
+
+	src, srcName := stdin, "stdin"
+	if cb != nil {
+		b, err := cb.Read()
+		if err != nil {
+			return err
+		}
+		src, srcName = bytes.NewReader(b), "the clipboard"
+	}
+	if target == "" || target == STDIO {
+		return errors.New("give the remote file to write")
+	}
+	// when stdin is the file, there is nobody to confirm (so `--yes` is needed, if the policy confirms pushes)
+	if err = confirm.Environment(env, fmt.Sprintf("push %s to %s", srcName, target), opts.AssumeYes != nil && *opts.AssumeYes); err != nil {
+		return err
+	}
+	c, err := ssh.RemoteCommand(cfg, env, instance, getWriteCommand(target))
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	counter := &countingReader{r: src}
+	c.Stdin, c.Stderr = counter, &stderr
+	if err = c.Run(); err != nil {
+		return fmt.Errorf("cannot write %s on %s: %w: %s", target, instance.InstanceId, err, strings.TrimSpace(stderr.String()))
+	}
+	out.Highlight(lvl, "wrote %s from %s to %s", formatBytes(counter.Count()), srcName, target)
+	return nil
+}
@@ -0,0 +1,162 @@
+package scp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/cli"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/confirm"
+	"github.com/ONSdigital/dp-cli/out"
+	"github.com/ONSdigital/dp-cli/ssh"
+)
+
+// SyncOptions holds the state of the `dp sync` flags given
+type SyncOptions struct {
+	IsPull      *bool
+	IsChecksum  *bool
+	IsDeleting  *bool
+	IsDryRun    *bool
+	IsConfirmed *bool
+	Excludes    *[]string
+	Verbosity   *int
+	AssumeYes   *bool
+}
+
+// getSyncArgs returns the rsync args to make `remoteDir` on the instance (`userHost`) the same as
+// `localDir` (or, when pulling, the reverse). rsync connects with `ssh -F ssh.cfg`, so must run in the ansible dir
+func getSyncArgs(opts SyncOptions, userHost, localDir, remoteDir string) []string {
+	args := []string{"--archive", "--compress", "--itemize-changes", "--human-readable", "--rsh", "ssh -F ssh.cfg"}
+	for v := 0; v < *opts.Verbosity; v++ {
+		args = append(args, "--verbose")
+	}
+	if *opts.IsChecksum {
+		args = append(args, "--checksum")
+	}
+	if *opts.IsDeleting {
+		args = append(args, "--delete")
+	}
+	if *opts.IsDryRun {
+		args = append(args, "--dry-run")
+	}
+	if opts.Excludes != nil {
+		for _, exclude := range *opts.Excludes {
+			args = append(args, "--exclude", exclude)
+		}
+	}
+
+	// the trailing slash syncs the contents of the source dir (rather than the dir itself) into the target
+	remote := userHost + ":" + remoteDir
+	if *opts.IsPull {
+		return append(args, withTrailingSlash(remote), localDir)
+	}
+	return append(args, withTrailingSlash(localDir), remote)
+}
+
+// isExcluded returns whether rsync would skip the file `relPath` (relative to the synced dir) for the `excludes`.
+// It follows rsync's main rules: a pattern with a trailing `/` only matches dirs, one with a leading `/` is anchored
+// to the synced dir, one with another `/` matches the end of the path, and any other matches the name of the file
+// or of a dir it is in (`**` is treated as `*`)
+func isExcluded(relPath string, excludes []string) bool {
+	parts := strings.Split(relPath, "/")
+	for _, exclude := range excludes {
+		pattern := strings.ReplaceAll(exclude, "**", "*")
+		isDirOnly := strings.HasSuffix(pattern, "/")
+		pattern = strings.TrimSuffix(pattern, "/")
+		isAnchored := strings.HasPrefix(pattern, "/")
+		pattern = strings.TrimPrefix(pattern, "/")
+		isPath := strings.Contains(pattern, "/")
+
+		// the file is excluded if it, or any dir it is in, matches
+		for end := 1; end <= len(parts); end++ {
+			if isDirOnly && end == len(parts) {
+				break
+			}
+			for start := 0; start < end; start++ {
+				if (isAnchored && start > 0) || (!isAnchored && !isPath && start < end-1) {
+					continue
+				}
+				if isMatch, _ := path.Match(pattern, strings.Join(parts[start:end], "/")); isMatch {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func withTrailingSlash(dir string) string {
+	if strings.HasSuffix(dir, "/") {
+		return dir
+	}
+	return dir + "/"
+}
+
+// Sync makes the remote dir on the instance the same as the local dir (or, when pulling, the reverse),
+// only copying files which have changed
+func Sync(cfg *config.Config, env config.Environment, instance aws.EC2Result, opts SyncOptions, localDir, remoteDir string) (err error) {
+	if cfg.SSHUser == nil || len(*cfg.SSHUser) == 0 {
+		out.Highlight(out.WARN, "no %s is defined in your configuration file you can view the app configuration values using the %s command", "ssh-user", "spew config")
+		return errors.New("missing `ssh-user` in config file")
+	}
+	if localDir, err = withCWD(localDir); err != nil {
+		out.Highlight(out.WARN, "could not determine your cwd")
+		return err
+	}
+	if !*opts.IsPull {
+		if info, err := os.Stat(localDir); err != nil {
+			out.Highlight(out.WARN, "could not access local dir: %s", localDir)
+			return err
+		} else if !info.IsDir() {
+			return fmt.Errorf("%s is not a dir", localDir)
+		}
+	}
+
+	verb, from, to := "pushing", localDir, remoteDir
+	if *opts.IsPull {
+		verb, from, to = "pulling", remoteDir, localDir
+	}
+	if *opts.IsDryRun {
+		verb += " (dry run)"
+	}
+	lvl := out.GetLevel(env)
+	out.Highlight(lvl, "Sync %s for %s (%s -> %s)", verb, env.Name, from, to)
+	out.Highlight(lvl, "[IP: %s | Name: %s | Id %s | Groups %s | AKA %s]", instance.IPAddress, instance.Name, instance.InstanceId, instance.AnsibleGroups, strings.Join(instance.GroupAKA, ", "))
+
+	if !*opts.IsDryRun {
+		if *opts.IsPull {
+			var excludes []string
+			if opts.Excludes != nil {
+				excludes = *opts.Excludes
+			}
+			if err = approvePull(cfg, env, []aws.EC2Result{instance}, []string{remoteDir}, excludes, localDir, *opts.IsConfirmed); err != nil {
+				return err
+			}
+		} else {
+			action := fmt.Sprintf("sync %s to %s", localDir, remoteDir)
+			if *opts.IsDeleting {
+				action += " (deleting remote files not in " + localDir + ")"
+			}
+			if err = confirm.Environment(env, action, opts.AssumeYes != nil && *opts.AssumeYes); err != nil {
+				return err
+			}
+		}
+	}
+
+	userHost, profile := ssh.GetUserHost(cfg, env, instance)
+	sigs := cli.CatchSignals()
+	defer sigs.Stop()
+
+	c := sigs.Command("rsync", getSyncArgs(opts, userHost, localDir, remoteDir)...)
+	c.Dir = cfg.GetAnsibleDirectory(env)
+	c.Env = os.Environ()
+	if profile != "" {
+		c.Env = append(c.Env, "AWS_PROFILE="+profile)
+	}
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return c.Run()
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Recording is a recorded session in the recordings dir
+type Recording struct {
+	Name   string // the file name without EXTENSION
+	Path   string
+	Header Header
+}
+
+// List returns the recordings in `dir`, oldest first
+func List(dir string) ([]Recording, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+EXTENSION))
+	if err != nil {
+		return nil, err
+	}
+	var recordings []Recording
+	for _, file := range files {
+		h, err := ReadHeader(file)
+		if err != nil {
+			continue
+		}
+		recordings = append(recordings, Recording{Name: strings.TrimSuffix(filepath.Base(file), EXTENSION), Path: file, Header: h})
+	}
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].Header.Session.Started.Before(recordings[j].Header.Session.Started)
+	})
+	return recordings, nil
+}
+
+// Find returns the path of the recording `name` (a name from List, or a path to a recording)
+func Find(dir, name string) (string, error) {
+	for _, path := range []string{name, filepath.Join(dir, name), filepath.Join(dir, name+EXTENSION)} {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no recording %q in %s", name, dir)
+}
+
+// Play writes the output of the recording at `path` to `w`, with its original timing changed by `speed`.
+// Pauses longer than `maxIdle` (if not zero) are shortened to it
+func Play(path string, w io.Writer, speed float64, maxIdle time.Duration) error {
+	if speed <= 0 {
+		return errors.New("speed must be greater than zero")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if !scanner.Scan() {
+		return fmt.Errorf("%s is empty", path)
+	}
+	var h Header
+	if err = json.Unmarshal(scanner.Bytes(), &h); err != nil {
+		return fmt.Errorf("%s is not a recording: %w", path, err)
+	}
+
+	last := 0.0
+	for scanner.Scan() {
+		var event []interface{}
+		if err = json.Unmarshal(scanner.Bytes(), &event); err != nil || len(event) != 3 {
+			return fmt.Errorf("%s has a bad event: %s", path, scanner.Text())
+		}
+		at, _ := event[0].(float64)
+		eventType, _ := event[1].(string)
+		data, _ := event[2].(string)
+		if eventType != eventOutput {
+			continue
+		}
+
+		delay := time.Duration((at - last) / speed * float64(time.Second))
+		if maxIdle > 0 && delay > maxIdle {
+			delay = maxIdle
+		}
+		time.Sleep(delay)
+		last = at
+
+		if _, err = io.WriteString(w, data); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
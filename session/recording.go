@@ -0,0 +1,221 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// EXTENSION is the file extension of recordings (asciicast v2, see https://docs.asciinema.org/manual/asciicast/v2/)
+const EXTENSION = ".cast"
+
+// event types in a recording
+const (
+	eventOutput = "o"
+	eventInput  = "i"
+	eventResize = "r"
+)
+
+// Meta describes the ssh session that was recorded
+type Meta struct {
+	Environment string    `json:"environment"`
+	Instance    string    `json:"instance"` // e.g. "publishing 1"
+	InstanceID  string    `json:"instance_id"`
+	User        string    `json:"user"`
+	SSHUser     string    `json:"ssh_user"`
+	Command     []string  `json:"command,omitempty"`
+	Started     time.Time `json:"started"`
+	Ended       time.Time `json:"ended"`
+}
+
+// Header is the first line of an asciicast v2 recording (with the session Meta added)
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Duration  float64           `json:"duration,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	Session   Meta              `json:"dp_session"`
+}
+
+// Recorder writes a timestamped recording of a session's input and output.
+// Events are written to a `.part` file, then the recording (with its header,
+// which needs the end time) is written by Close
+type Recorder struct {
+	mu      sync.Mutex
+	path    string
+	part    *os.File
+	events  *bufio.Writer
+	header  Header
+	pending map[string][]byte // incomplete UTF-8 at the end of the last chunk, per event type
+}
+
+// NewRecorder starts a recording in `dir` of a terminal of size `width` x `height`
+func NewRecorder(dir string, meta Meta, width, height int) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	meta.Started = time.Now()
+	name := fmt.Sprintf("%s-%s-%s%s", meta.Started.Format("20060102T150405"), meta.Environment, meta.InstanceID, EXTENSION)
+	path := filepath.Join(dir, name)
+
+	part, err := os.OpenFile(path+".part", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		path:   path,
+		part:   part,
+		events: bufio.NewWriter(part),
+		header: Header{
+			Version:   2,
+			Width:     width,
+			Height:    height,
+			Timestamp: meta.Started.Unix(),
+			Title:     fmt.Sprintf("dp ssh %s %s (%s)", meta.Environment, meta.Instance, meta.InstanceID),
+			Env:       map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+			Session:   meta,
+		},
+		pending: make(map[string][]byte),
+	}, nil
+}
+
+// Path is the file the recording is written to (on Close)
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// Output records output from the session
+func (r *Recorder) Output(p []byte) {
+	r.write(eventOutput, p)
+}
+
+// Input records input to the session
+func (r *Recorder) Input(p []byte) {
+	r.write(eventInput, p)
+}
+
+// Resize records a change in the terminal size
+func (r *Recorder) Resize(width, height int) {
+	r.write(eventResize, []byte(fmt.Sprintf("%dx%d", width, height)))
+}
+
+// writer returns a writer which records to the event type
+func (r *Recorder) writer(eventType string) io.Writer {
+	return recordWriter(func(p []byte) { r.write(eventType, p) })
+}
+
+type recordWriter func(p []byte)
+
+func (w recordWriter) Write(p []byte) (int, error) {
+	w(p)
+	return len(p), nil
+}
+
+func (r *Recorder) write(eventType string, p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.pending[eventType], p...)
+	cut := completeUTF8(data)
+	r.pending[eventType] = append([]byte{}, data[cut:]...)
+	if cut == 0 {
+		return
+	}
+
+	elapsed := time.Since(r.header.Session.Started).Seconds()
+	b, err := json.Marshal([]interface{}{elapsed, eventType, string(data[:cut])})
+	if err != nil {
+		return
+	}
+	r.events.Write(b)
+	r.events.WriteByte('\n')
+}
+
+// completeUTF8 returns the length of `data` without any incomplete UTF-8 sequence at its end
+func completeUTF8(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+// Close ends the recording, writing it (header then events) to Path
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for eventType, data := range r.pending {
+		if len(data) > 0 {
+			b, _ := json.Marshal([]interface{}{time.Since(r.header.Session.Started).Seconds(), eventType, string(data)})
+			r.events.Write(append(b, '\n'))
+		}
+	}
+	r.header.Session.Ended = time.Now()
+	r.header.Duration = r.header.Session.Ended.Sub(r.header.Session.Started).Seconds()
+
+	if err := r.events.Flush(); err != nil {
+		return err
+	}
+	if _, err := r.part.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	defer func() {
+		r.part.Close()
+		os.Remove(r.part.Name())
+	}()
+
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := json.Marshal(r.header)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	events, err := os.Open(r.part.Name())
+	if err != nil {
+		return err
+	}
+	defer events.Close()
+	_, err = io.Copy(f, events)
+	return err
+}
+
+// ReadHeader returns the header of the recording at `path`
+func ReadHeader(path string) (h Header, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return h, err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return h, err
+	}
+	if err = json.Unmarshal([]byte(strings.TrimSpace(line)), &h); err != nil {
+		return h, fmt.Errorf("%s is not a recording: %w", path, err)
+	}
+	return h, nil
+}
@@ -0,0 +1,20 @@
+package session
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// runPiped runs `c` without a terminal (e.g. when stdin is redirected), recording its stdio.
+// If `c.Stdin` is not set, the user's stdin is used
+func runPiped(c *exec.Cmd, rec *Recorder) error {
+	in := c.Stdin
+	if in == nil {
+		in = os.Stdin
+	}
+	c.Stdin = io.TeeReader(in, rec.writer(eventInput))
+	c.Stdout = io.MultiWriter(os.Stdout, rec.writer(eventOutput))
+	c.Stderr = io.MultiWriter(os.Stderr, rec.writer(eventOutput))
+	return c.Run()
+}
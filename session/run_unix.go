@@ -0,0 +1,112 @@
+//go:build !windows
+
+package session
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/term"
+)
+
+// TerminalSize returns the size of the user's terminal (80x24 if not a terminal)
+func TerminalSize() (width, height int) {
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		return w, h
+	}
+	return 80, 24
+}
+
+// Run runs `c` on a pseudo-terminal, proxying the user's terminal to it, while `rec` records the session.
+// If `c.Stdin` is set (or stdin is not a terminal), no pseudo-terminal is used
+func Run(c *exec.Cmd, rec *Recorder) error {
+	stdinFd := int(os.Stdin.Fd())
+	if c.Stdin != nil || !term.IsTerminal(stdinFd) {
+		return runPiped(c, rec)
+	}
+
+	ptmx, err := pty.StartWithSize(c, getSize(stdinFd))
+	if err != nil {
+		return err
+	}
+	defer ptmx.Close()
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer func() { signal.Stop(winch); close(winch) }()
+	go func() {
+		for range winch {
+			if err := pty.InheritSize(os.Stdin, ptmx); err == nil {
+				w, h := TerminalSize()
+				rec.Resize(w, h)
+			}
+		}
+	}()
+
+	oldState, err := term.MakeRaw(stdinFd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(stdinFd, oldState)
+
+	// stdin is read via a non-blocking dup, so that its reader can be stopped when the
+	// session ends (and not take input meant for the next session)
+	stdin, restoreStdin, err := openNonBlocking(stdinFd)
+	if err != nil {
+		return err
+	}
+	defer restoreStdin()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(io.MultiWriter(ptmx, rec.writer(eventInput)), stdin)
+	}()
+	go func() {
+		defer wg.Done()
+		// reading the pty fails (EIO) once the command has exited
+		io.Copy(io.MultiWriter(os.Stdout, rec.writer(eventOutput)), ptmx)
+	}()
+
+	err = c.Wait()
+	stdin.SetReadDeadline(time.Now())
+	wg.Wait()
+	return err
+}
+
+func getSize(fd int) *pty.Winsize {
+	w, h, err := term.GetSize(fd)
+	if err != nil {
+		return nil
+	}
+	return &pty.Winsize{Cols: uint16(w), Rows: uint16(h)}
+}
+
+// openNonBlocking returns a pollable (so deadlines can stop reads) copy of `fd`, and a func to restore it
+func openNonBlocking(fd int) (*os.File, func(), error) {
+	dup, err := syscall.Dup(fd)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = syscall.SetNonblock(dup, true); err != nil {
+		syscall.Close(dup)
+		return nil, nil, err
+	}
+	f := os.NewFile(uintptr(dup), "stdin")
+	if f == nil {
+		return nil, nil, errors.New("cannot open stdin")
+	}
+	return f, func() {
+		// the non-blocking flag is shared with `fd`
+		syscall.SetNonblock(dup, false)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package session
+
+import (
+	"os/exec"
+)
+
+// TerminalSize returns the size of the user's terminal
+func TerminalSize() (width, height int) {
+	return 80, 24
+}
+
+// Run runs `c` while `rec` records the session (pseudo-terminals are not supported on windows)
+func Run(c *exec.Cmd, rec *Recorder) error {
+	return runPiped(c, rec)
+}
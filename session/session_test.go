@@ -0,0 +1,68 @@
+package session
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecording(t *testing.T) {
+	Convey("Given a session is recorded", t, func() {
+		dir := t.TempDir()
+		meta := Meta{Environment: "sandbox", Instance: "publishing 1", InstanceID: "i-0123", User: "jane", SSHUser: "ubuntu"}
+		rec, err := NewRecorder(dir, meta, 120, 40)
+		So(err, ShouldBeNil)
+
+		rec.Input([]byte("ls\r"))
+		rec.Output([]byte("file\xe2\x82")) // a multi-byte rune split across writes
+		rec.Output([]byte("\xac\r\n"))
+		rec.Resize(100, 30)
+		So(rec.Close(), ShouldBeNil)
+
+		Convey("Then the recording should have a header describing the session", func() {
+			h, err := ReadHeader(rec.Path())
+			So(err, ShouldBeNil)
+			So(h.Version, ShouldEqual, 2)
+			So(h.Width, ShouldEqual, 120)
+			So(h.Session.Environment, ShouldEqual, "sandbox")
+			So(h.Session.InstanceID, ShouldEqual, "i-0123")
+			So(h.Session.User, ShouldEqual, "jane")
+			So(h.Session.Ended, ShouldHappenOnOrAfter, h.Session.Started)
+		})
+
+		Convey("Then the partial file should be removed", func() {
+			_, err := os.Stat(rec.Path() + ".part")
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("Then it should be listed", func() {
+			recordings, err := List(dir)
+			So(err, ShouldBeNil)
+			So(recordings, ShouldHaveLength, 1)
+			So(recordings[0].Path, ShouldEqual, rec.Path())
+
+			path, err := Find(dir, recordings[0].Name)
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, rec.Path())
+		})
+
+		Convey("Then playing it should only write the (whole) output", func() {
+			var buf bytes.Buffer
+			So(Play(rec.Path(), &buf, 10, time.Millisecond), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "file€\r\n")
+		})
+
+		Convey("Then it should be valid asciicast (a JSON event per line)", func() {
+			b, err := os.ReadFile(rec.Path())
+			So(err, ShouldBeNil)
+			lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+			So(lines, ShouldHaveLength, 5)
+			So(lines[1], ShouldContainSubstring, `"i","ls\r"`)
+			So(lines[4], ShouldContainSubstring, `"r","100x30"`)
+		})
+	})
+}
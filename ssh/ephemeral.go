@@ -0,0 +1,107 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/config"
+)
+
+// Forward is an ssh port-forward running in the background, e.g. for the duration of a request
+type Forward struct {
+	LocalPort int
+	cmd       *exec.Cmd
+	done      chan error
+	stderr    lockedBuffer
+	closeOnce sync.Once
+}
+
+// lockedBuffer is a bytes.Buffer which can be read while ssh is still writing to it
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// StartForward forwards a free local port to the service (a name from `services` in config, or a `[<host>:]<port>`)
+// via the instance. It returns once the local port accepts connections (or `timeout` passes)
+func StartForward(cfg *config.Config, env config.Environment, instance aws.EC2Result, service string, timeout time.Duration) (*Forward, error) {
+	port, err := getFreeLocalPort()
+	if err != nil {
+		return nil, fmt.Errorf("cannot find a free local port: %w", err)
+	}
+	services, err := cfg.GetServices(env)
+	if err != nil {
+		return nil, err
+	}
+	// expanded here (rather than by TunnelArgs) so that nothing is written to stdout
+	portArg, err := expandServicePortArg(strconv.Itoa(port)+":"+service, services, isLocalPortFree, getFreeLocalPort)
+	if err != nil {
+		return nil, err
+	}
+	args, profile, err := TunnelArgs(cfg, env, instance, []string{portArg})
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Forward{LocalPort: port, done: make(chan error, 1)}
+	f.cmd = exec.Command("ssh", args...)
+	f.cmd.Dir = cfg.GetAnsibleDirectory(env)
+	f.cmd.Env = os.Environ()
+	if profile != "" {
+		f.cmd.Env = append(f.cmd.Env, "AWS_PROFILE="+profile)
+	}
+	f.cmd.Stderr = &f.stderr
+	if err = f.cmd.Start(); err != nil {
+		return nil, err
+	}
+	go func() { f.done <- f.cmd.Wait() }()
+
+	addr := net.JoinHostPort("localhost", strconv.Itoa(port))
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case err := <-f.done:
+			f.closeOnce.Do(func() {})
+			return nil, fmt.Errorf("ssh port-forward to %s failed: %v: %s", service, err, strings.TrimSpace(f.stderr.String()))
+		default:
+		}
+		if conn, err := net.DialTimeout("tcp", addr, 200*time.Millisecond); err == nil {
+			conn.Close()
+			return f, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("ssh port-forward to %s not ready after %s: %s", service, timeout, strings.TrimSpace(f.stderr.String()))
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// Close stops the port-forward
+func (f *Forward) Close() error {
+	f.closeOnce.Do(func() {
+		f.cmd.Process.Kill()
+		<-f.done
+	})
+	return nil
+}
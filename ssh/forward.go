@@ -0,0 +1,159 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ssh flags for each type of forwarding
+const (
+	localForwardFlag   = "-L"
+	remoteForwardFlag  = "-R"
+	dynamicForwardFlag = "-D"
+	jumpHostFlag       = "-J"
+)
+
+var (
+	validHostname = regexp.MustCompile(`^[-A-Za-z0-9._]+$`)
+	validIPv6     = regexp.MustCompile(`^\[([0-9A-Fa-f:.]+)(?:%[-A-Za-z0-9._]+)?\]$`)
+	validUser     = regexp.MustCompile(`^[-A-Za-z0-9._]+$`)
+)
+
+// getSSHPortArguments returns the ssh args for a local forward (`-L`), see getSSHForwardArguments
+func getSSHPortArguments(portArg string) ([]string, error) {
+	return getSSHForwardArguments(localForwardFlag, portArg)
+}
+
+// getSSHRemoteForwardArguments returns the ssh args for a remote forward (`-R`), see getSSHForwardArguments
+func getSSHRemoteForwardArguments(portArg string) ([]string, error) {
+	return getSSHForwardArguments(remoteForwardFlag, portArg)
+}
+
+// getSSHForwardArguments returns the ssh args for `flag` (-L or -R) to forward `portArg` of the form:
+//
+//	<port>				# same port, to localhost
+//	<listen>:<port>			# to localhost
+//	<listen>:<host>:<port>		# host may be a name, IPv4 or [IPv6]
+//	<listen>:<socket>		# a unix socket (absolute path) as the target
+//
+// where <listen> is a port, or a unix socket (absolute path).
+// For -L the listen side is local (the target remote), for -R it is the reverse.
+func getSSHForwardArguments(flag, portArg string) ([]string, error) {
+	invalidErr := fmt.Errorf("%q is not a valid port forwarding argument", portArg)
+
+	parts, ok := splitForwardArg(portArg)
+	if !ok || len(parts) < 1 || len(parts) > 3 {
+		return nil, invalidErr
+	}
+
+	listen := parts[0]
+	if !isValidPort(listen) && !isValidSocket(listen) {
+		return nil, invalidErr
+	}
+
+	var target string
+	switch len(parts) {
+	case 1:
+		if !isValidPort(listen) {
+			return nil, invalidErr
+		}
+		target = "localhost:" + listen
+	case 2:
+		if isValidPort(parts[1]) {
+			target = "localhost:" + parts[1]
+		} else if isValidSocket(parts[1]) {
+			target = parts[1]
+		} else {
+			return nil, invalidErr
+		}
+	case 3:
+		if !isValidHost(parts[1]) || !isValidPort(parts[2]) {
+			return nil, invalidErr
+		}
+		target = parts[1] + ":" + parts[2]
+	}
+
+	return []string{flag, listen + ":" + target}, nil
+}
+
+// getSSHSocksArguments returns the ssh args for a SOCKS proxy (`-D`) of the form `[<bind_address>:]<port>`
+func getSSHSocksArguments(socksArg string) ([]string, error) {
+	invalidErr := fmt.Errorf("%q is not a valid SOCKS argument (expected `[<bind_address>:]<port>`)", socksArg)
+
+	parts, ok := splitForwardArg(socksArg)
+	if !ok || len(parts) < 1 || len(parts) > 2 || !isValidPort(parts[len(parts)-1]) {
+		return nil, invalidErr
+	}
+	if len(parts) == 2 && !isValidHost(parts[0]) {
+		return nil, invalidErr
+	}
+	return []string{dynamicForwardFlag, socksArg}, nil
+}
+
+// getSSHJumpHostArguments returns the ssh args to connect via jump host[s] (`-J`),
+// given as a comma-separated list of `[<user>@]<host>[:<port>]`
+func getSSHJumpHostArguments(jumpArg string) ([]string, error) {
+	invalidErr := fmt.Errorf("%q is not a valid jump host argument (expected `[<user>@]<host>[:<port>][,...]`)", jumpArg)
+
+	for _, jump := range strings.Split(jumpArg, ",") {
+		if user, host, hasUser := strings.Cut(jump, "@"); hasUser {
+			if !validUser.MatchString(user) {
+				return nil, invalidErr
+			}
+			jump = host
+		}
+		parts, ok := splitForwardArg(jump)
+		if !ok || len(parts) < 1 || len(parts) > 2 || !isValidHost(parts[0]) {
+			return nil, invalidErr
+		}
+		if len(parts) == 2 && !isValidPort(parts[1]) {
+			return nil, invalidErr
+		}
+	}
+	return []string{jumpHostFlag, jumpArg}, nil
+}
+
+// splitForwardArg splits `arg` on colons, except within [IPv6] brackets
+func splitForwardArg(arg string) (parts []string, ok bool) {
+	var part strings.Builder
+	inBrackets := false
+	for _, r := range arg {
+		switch {
+		case r == '[' && !inBrackets:
+			inBrackets = true
+		case r == ']' && inBrackets:
+			inBrackets = false
+		case r == ':' && !inBrackets:
+			parts = append(parts, part.String())
+			part.Reset()
+			continue
+		}
+		part.WriteRune(r)
+	}
+	if inBrackets {
+		return nil, false
+	}
+	return append(parts, part.String()), true
+}
+
+func isValidPort(s string) bool {
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return false
+	}
+	port, err := strconv.Atoi(s)
+	return err == nil && port > 0 && port <= 65535
+}
+
+func isValidSocket(s string) bool {
+	return strings.HasPrefix(s, "/") && len(s) > 1 && !strings.ContainsAny(s, " \t\n")
+}
+
+func isValidHost(s string) bool {
+	if m := validIPv6.FindStringSubmatch(s); m != nil {
+		return net.ParseIP(m[1]) != nil
+	}
+	return validHostname.MatchString(s)
+}
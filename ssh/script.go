@@ -0,0 +1,64 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultInterpreter runs scripts that have no `#!` line
+const defaultInterpreter = "sh"
+
+// readScript returns the contents of the local script, and the remote command which runs it (with `args`)
+// when it is streamed to the remote's stdin
+func readScript(path string, args []string, isSudo bool) (script []byte, remoteCmd string, err error) {
+	if script, err = os.ReadFile(path); err != nil {
+		return nil, "", fmt.Errorf("cannot read script: %w", err)
+	}
+	return script, getScriptCommand(script, args, isSudo), nil
+}
+
+// getScriptCommand returns the remote command line that runs the script (from stdin) with its interpreter
+// (from any `#!` line, else `sh`), and `args`
+func getScriptCommand(script []byte, args []string, isSudo bool) string {
+	words := getInterpreter(script)
+	if isSudo {
+		words = append([]string{"sudo"}, words...)
+	}
+	// the interpreter reads the script from stdin, leaving args as the script's `$1`...
+	words = append(words, "/dev/stdin")
+	for _, arg := range args {
+		words = append(words, ShellQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// getInterpreter returns the words of the script's `#!` line, else the default interpreter
+func getInterpreter(script []byte) []string {
+	firstLine, _, _ := strings.Cut(string(script), "\n")
+	interpreter, ok := strings.CutPrefix(strings.TrimSpace(firstLine), "#!")
+	if !ok {
+		return []string{defaultInterpreter}
+	}
+	words := strings.Fields(interpreter)
+	if len(words) == 0 {
+		return []string{defaultInterpreter}
+	}
+	for i := range words {
+		words[i] = ShellQuote(words[i])
+	}
+	return words
+}
+
+// ShellQuote quotes `s` (if needed) for the remote shell
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,+@%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
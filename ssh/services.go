@@ -0,0 +1,98 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/out"
+)
+
+// getPortArguments returns the ssh args for all `portArgs`, any of which may name a service (see expandServicePortArg)
+func getPortArguments(cfg *config.Config, env config.Environment, portArgs []string) ([]string, error) {
+	if len(portArgs) == 0 {
+		return nil, nil
+	}
+	services, err := cfg.GetServices(env)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	for _, portArg := range portArgs {
+		expanded, err := expandServicePortArg(portArg, services, isLocalPortFree, getFreeLocalPort)
+		if err != nil {
+			return nil, err
+		}
+		if expanded != portArg {
+			out.Highlight(out.INFO, "forwarding %s as %s", portArg, expanded)
+		}
+		sshPortArgs, err := getSSHPortArguments(expanded)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, sshPortArgs...)
+	}
+	return args, nil
+}
+
+// expandServicePortArg expands a port-forwarding arg of `<service>` or `<local>:<service>` into
+// `<local>:<host>:<remote>` from `services`. For `<service>`, the local port is the service's
+// `local-port` (else its port) - or any free port, when that one is busy.
+// Other port-forwarding args are returned unchanged.
+func expandServicePortArg(portArg string, services map[string]config.Service, isPortFree func(int) bool, freePort func() (int, error)) (string, error) {
+	localPort, name, hasLocal := strings.Cut(portArg, ":")
+	if !hasLocal {
+		name, localPort = portArg, ""
+	}
+	svc, ok := services[name]
+	if !ok || strings.Contains(name, ":") {
+		return portArg, nil
+	}
+	if svc.Port <= 0 {
+		return "", fmt.Errorf("service %q has no port in config", name)
+	}
+
+	host := svc.Host
+	if host == "" {
+		host = "localhost"
+	}
+
+	if localPort == "" {
+		local := svc.LocalPort
+		if local <= 0 {
+			local = svc.Port
+		}
+		if !isPortFree(local) {
+			free, err := freePort()
+			if err != nil {
+				return "", fmt.Errorf("local port %d for service %q is busy, and cannot find a free port: %w", local, name, err)
+			}
+			out.Highlight(out.WARN, "local port %s for service %s is busy - using %s", local, name, free)
+			local = free
+		}
+		localPort = strconv.Itoa(local)
+	}
+
+	return fmt.Sprintf("%s:%s:%d", localPort, host, svc.Port), nil
+}
+
+func isLocalPortFree(port int) bool {
+	l, err := net.Listen("tcp", net.JoinHostPort("localhost", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+func getFreeLocalPort() (int, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
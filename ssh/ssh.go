@@ -1,25 +1,44 @@
 package ssh
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"regexp"
 	"strings"
 
 	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/cli"
 	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/confirm"
 	"github.com/ONSdigital/dp-cli/out"
+	"github.com/ONSdigital/dp-cli/session"
 )
 
 type SSHOpts struct {
 	PortArgs       *[]string
+	RemotePortArgs *[]string
+	SocksArg       *string
+	JumpHostArg    *string
 	QuietFlag      *bool
 	InstanceNumMax *int
 	VerboseCount   *int
+	RecordFlag     *bool
+	AssumeYes      *bool
+	ScriptArg      *string
+	SudoFlag       *bool
+	ExitPolicy     *string
 }
 
+// exit policies choose the exit code of dp for a command run on several instances
+const (
+	EXIT_FIRST = "first" // stop at the first failure, exiting with its code
+	EXIT_MAX   = "max"   // run on all instances, exiting with the highest code
+	EXIT_COUNT = "count" // run on all instances, exiting with the number of failures
+)
+
 // Launch an ssh connection to the specified environment
 func Launch(cfg *config.Config, env config.Environment, instanceNum int, opts SSHOpts, extraArgs []string, instances []aws.EC2Result) (err error) {
 	if cfg.SSHUser == nil || len(*cfg.SSHUser) == 0 {
@@ -27,7 +46,16 @@ func Launch(cfg *config.Config, env config.Environment, instanceNum int, opts SS
 		return errors.New("missing `ssh-user` in config file (or no `--user`)")
 	}
 
+	exitPolicy := EXIT_FIRST
+	if opts.ExitPolicy != nil && len(*opts.ExitPolicy) > 0 {
+		exitPolicy = *opts.ExitPolicy
+	}
+	if exitPolicy != EXIT_FIRST && exitPolicy != EXIT_MAX && exitPolicy != EXIT_COUNT {
+		return fmt.Errorf("unknown exit policy %q (use %s, %s or %s)", exitPolicy, EXIT_FIRST, EXIT_MAX, EXIT_COUNT)
+	}
+
 	isQuiet := opts.QuietFlag != nil && *opts.QuietFlag
+	isRecording := (opts.RecordFlag != nil && *opts.RecordFlag) || env.GetPolicy().IsRecordingSessions()
 	lvl := out.GetLevel(env)
 
 	instanceMax := instanceNum
@@ -37,6 +65,33 @@ func Launch(cfg *config.Config, env config.Environment, instanceNum int, opts SS
 		instanceMax = *opts.InstanceNumMax - 1
 	}
 
+	// with a script, extraArgs are its args and the remote command runs it from stdin
+	var script []byte
+	if opts.ScriptArg != nil && len(*opts.ScriptArg) > 0 {
+		var remoteCmd string
+		if script, remoteCmd, err = readScript(*opts.ScriptArg, extraArgs, opts.SudoFlag != nil && *opts.SudoFlag); err != nil {
+			return err
+		}
+		extraArgs = []string{remoteCmd}
+	} else if opts.SudoFlag != nil && *opts.SudoFlag {
+		return errors.New("`--sudo` needs `--script`")
+	}
+
+	if len(extraArgs) > 0 {
+		action := fmt.Sprintf("run %q on %d instance(s)", strings.Join(extraArgs, " "), instanceMax-instanceNum+1)
+		if script != nil {
+			action = fmt.Sprintf("run script %s (as %q) on %d instance(s)", *opts.ScriptArg, extraArgs[0], instanceMax-instanceNum+1)
+		}
+		if err = confirm.Environment(env, action, opts.AssumeYes != nil && *opts.AssumeYes); err != nil {
+			return err
+		}
+	}
+
+	// SIGINT and SIGTERM are forwarded to ssh, then stop the loop
+	sigs := cli.CatchSignals()
+	defer sigs.Stop()
+	failures, maxCode := 0, 0
+
 	for instanceNumLoop := instanceNum; instanceNumLoop <= instanceMax; instanceNumLoop++ {
 		instance := instances[instanceNumLoop]
 		if isQuiet {
@@ -47,27 +102,41 @@ func Launch(cfg *config.Config, env config.Environment, instanceNum int, opts SS
 		}
 		ansibleDir := cfg.GetAnsibleDirectory(env)
 
-		var userHost string
 		args := []string{"-F", "ssh.cfg"}
-		sshUser := *cfg.SSHUser
-		if len(env.SSHUser) > 0 {
-			sshUser = env.SSHUser
-		}
 
 		if opts.PortArgs != nil {
-			for _, portArg := range *opts.PortArgs {
-				sshPortArgs, err := getSSHPortArguments(portArg)
+			sshPortArgs, err := getPortArguments(cfg, env, *opts.PortArgs)
+			if err != nil {
+				return err
+			}
+			args = append(args, sshPortArgs...)
+		}
+		if opts.RemotePortArgs != nil {
+			for _, portArg := range *opts.RemotePortArgs {
+				sshPortArgs, err := getSSHRemoteForwardArguments(portArg)
 				if err != nil {
 					return err
 				}
 				args = append(args, sshPortArgs...)
 			}
 		}
-		if env.IsAWSA() {
-			userHost = fmt.Sprintf("%s@%s", sshUser, instance.IPAddress)
-		} else {
-			os.Setenv("AWS_PROFILE", cfg.GetProfile(env.Name))
-			userHost = fmt.Sprintf("%s@%s", sshUser, instance.InstanceId)
+		if opts.SocksArg != nil && len(*opts.SocksArg) > 0 {
+			sshSocksArgs, err := getSSHSocksArguments(*opts.SocksArg)
+			if err != nil {
+				return err
+			}
+			args = append(args, sshSocksArgs...)
+		}
+		if opts.JumpHostArg != nil && len(*opts.JumpHostArg) > 0 {
+			sshJumpArgs, err := getSSHJumpHostArguments(*opts.JumpHostArg)
+			if err != nil {
+				return err
+			}
+			args = append(args, sshJumpArgs...)
+		}
+		userHost, profile := GetUserHost(cfg, env, instance)
+		if profile != "" {
+			os.Setenv("AWS_PROFILE", profile)
 		}
 		for v := 0; v < *opts.VerboseCount; v++ {
 			args = append(args, "-v")
@@ -80,48 +149,157 @@ func Launch(cfg *config.Config, env config.Environment, instanceNum int, opts SS
 			fmt.Println(args)
 		}
 
-		if err = execCommand(ansibleDir, isQuiet, "ssh", args...); err != nil {
-			return
+		var rec *session.Recorder
+		if isRecording {
+			if rec, err = newRecorder(cfg, env, instance, args); err != nil {
+				return err
+			}
+			out.Highlight(lvl, "Recording session to %s", rec.Path())
+		}
+		var stdin io.Reader
+		if script != nil {
+			stdin = bytes.NewReader(script)
+		}
+		err = execCommand(sigs, ansibleDir, isQuiet, rec, stdin, "ssh", args...)
+		if rec != nil {
+			if closeErr := rec.Close(); closeErr != nil {
+				out.WarnFHighlight("cannot save session recording: %s", closeErr)
+			}
+		}
+
+		if sig := sigs.Signal(); sig != nil {
+			msg := fmt.Sprintf("interrupted (%s) on %s %s", sig, env.Name, instance.InstanceId)
+			if skipped := instanceMax - instanceNumLoop; skipped > 0 {
+				msg += fmt.Sprintf(" - skipped %d remaining instance(s)", skipped)
+			}
+			return cli.ExitError{Code: cli.SignalExitCode(sig), Err: errors.New(msg)}
+		}
+		if err != nil {
+			code := cli.ExitCode(err)
+			err = cli.ExitError{Code: code, Err: fmt.Errorf("ssh to %s %s failed: %w", env.Name, instance.InstanceId, err)}
+			if exitPolicy == EXIT_FIRST {
+				return err
+			}
+			out.WarnFHighlight("%s", err)
+			failures++
+			maxCode = max(maxCode, code)
 		}
 	}
-	return
+
+	switch {
+	case failures == 0:
+		return nil
+	case exitPolicy == EXIT_COUNT:
+		return cli.ExitError{Code: min(failures, 255), Err: fmt.Errorf("failed on %d of %d instance(s)", failures, instanceMax-instanceNum+1)}
+	default:
+		return cli.ExitError{Code: maxCode, Err: fmt.Errorf("failed on %d of %d instance(s) (highest exit code %d)", failures, instanceMax-instanceNum+1, maxCode)}
+	}
 }
 
-func execCommand(wrkDir string, isQuiet bool, command string, arg ...string) error {
-	c := exec.Command(command, arg...)
-	c.Stderr = os.Stderr
-	c.Stdin = os.Stdin
-	c.Stdout = os.Stdout
+// GetUserHost returns the ssh `user@host` for the instance, and the AWS profile
+// that ssh.cfg needs to reach it (empty when the policy targets the instance IP)
+func GetUserHost(cfg *config.Config, env config.Environment, instance aws.EC2Result) (userHost, profile string) {
+	sshUser := *cfg.SSHUser
+	if len(env.SSHUser) > 0 {
+		sshUser = env.SSHUser
+	}
+	if env.GetPolicy().IsSSHByIP() {
+		return fmt.Sprintf("%s@%s", sshUser, instance.IPAddress), ""
+	}
+	return fmt.Sprintf("%s@%s", sshUser, instance.InstanceId), cfg.GetProfile(env.Name)
+}
+
+// TunnelArgs returns the ssh args (to run in the ansible dir) which only forward `portArgs` to
+// the instance (no shell), exiting if the forwarding fails or the connection stops responding
+func TunnelArgs(cfg *config.Config, env config.Environment, instance aws.EC2Result, portArgs []string) (args []string, profile string, err error) {
+	if cfg.SSHUser == nil || len(*cfg.SSHUser) == 0 {
+		return nil, "", errors.New("missing `ssh-user` in config file (or no `--user`)")
+	}
+	if len(portArgs) == 0 {
+		return nil, "", errors.New("no port forwarding rules given (use `--port`)")
+	}
+
+	args = []string{"-F", "ssh.cfg", "-N",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ServerAliveInterval=15",
+		"-o", "ServerAliveCountMax=3",
+	}
+	sshPortArgs, err := getPortArguments(cfg, env, portArgs)
+	if err != nil {
+		return nil, "", err
+	}
+	args = append(args, sshPortArgs...)
+	userHost, profile := GetUserHost(cfg, env, instance)
+	return append(args, userHost), profile, nil
+}
+
+// newRecorder starts a recording of the ssh session (args) to the instance
+func newRecorder(cfg *config.Config, env config.Environment, instance aws.EC2Result, args []string) (*session.Recorder, error) {
+	meta := session.Meta{
+		Environment: env.Name,
+		Instance:    instance.Name,
+		InstanceID:  instance.InstanceId,
+		SSHUser:     *cfg.SSHUser,
+		Command:     append([]string{"ssh"}, args...),
+	}
+	if len(env.SSHUser) > 0 {
+		meta.SSHUser = env.SSHUser
+	}
+	if cfg.UserName != nil {
+		meta.User = *cfg.UserName
+	}
+	width, height := session.TerminalSize()
+	rec, err := session.NewRecorder(cfg.GetRecordingsDir(), meta, width, height)
+	if err != nil {
+		return nil, fmt.Errorf("cannot record session: %w", err)
+	}
+	return rec, nil
+}
+
+// RemoteCommand returns a command (to be started by the caller) which runs `remoteArgs` on the instance
+// without a terminal, e.g. to read its output
+func RemoteCommand(cfg *config.Config, env config.Environment, instance aws.EC2Result, remoteArgs ...string) (*exec.Cmd, error) {
+	return RemoteCommandWithOptions(cfg, env, instance, nil, remoteArgs...)
+}
+
+// RemoteCommandWithOptions is RemoteCommand, with extra ssh options (e.g. `-o ControlMaster=auto`)
+func RemoteCommandWithOptions(cfg *config.Config, env config.Environment, instance aws.EC2Result, sshOpts []string, remoteArgs ...string) (*exec.Cmd, error) {
+	if cfg.SSHUser == nil || len(*cfg.SSHUser) == 0 {
+		return nil, errors.New("missing `ssh-user` in config file (or no `--user`)")
+	}
+	userHost, profile := GetUserHost(cfg, env, instance)
+	args := append([]string{"-F", "ssh.cfg", "-T"}, sshOpts...)
+	args = append(append(args, userHost), remoteArgs...)
+
+	c := exec.Command("ssh", args...)
+	c.Dir = cfg.GetAnsibleDirectory(env)
+	c.Env = os.Environ()
+	if profile != "" {
+		c.Env = append(c.Env, "AWS_PROFILE="+profile)
+	}
+	return c, nil
+}
+
+// execCommand runs the command in `wrkDir` with `stdin` (if nil, the user's stdin) -
+// recording it with `rec`, if not nil. Signals caught by `sigs` are forwarded to it
+func execCommand(sigs *cli.SignalForwarder, wrkDir string, isQuiet bool, rec *session.Recorder, stdin io.Reader, command string, arg ...string) error {
+	c := sigs.Command(command, arg...)
+	c.Stdin = stdin
 	c.Env = os.Environ()
 	if isQuiet {
 		c.Env = append(c.Env, "ONS_DP_QUIET=1")
 	}
 	c.Dir = wrkDir
+	if rec != nil {
+		return session.Run(c, rec)
+	}
+	if stdin == nil {
+		c.Stdin = os.Stdin
+	}
+	c.Stderr = os.Stderr
+	c.Stdout = os.Stdout
 	if err := c.Run(); err != nil {
 		return err
 	}
 	return nil
 }
-
-func getSSHPortArguments(portArg string) ([]string, error) {
-	validPort := regexp.MustCompile(
-		`^(?P<local_port>[0-9]+)` +
-			`(?:` +
-			`(?:` + `:(?P<remote_host>[-a-z0-9._]+)` + `)?` +
-			`(?:` + `:(?P<remote_port>[0-9]+)` + `)` +
-			`)?$`,
-	)
-	if !validPort.MatchString(portArg) {
-		return nil, fmt.Errorf("%q is not a valid port forwarding argument", portArg)
-	}
-
-	ports := strings.Split(portArg, ":")
-	localPort, host, remotePort := ports[0], "localhost", ports[0]
-	if len(ports) == 2 {
-		remotePort = ports[1]
-	} else if len(ports) == 3 {
-		host, remotePort = ports[1], ports[2]
-	}
-	sshPortArg := fmt.Sprintf("%s:%s:%s", localPort, host, remotePort)
-	return []string{"-L", sshPortArg}, nil
-}
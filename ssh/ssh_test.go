@@ -2,8 +2,15 @@ package ssh
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/ONSdigital/dp-cli/aws"
+	"github.com/ONSdigital/dp-cli/cli"
+	"github.com/ONSdigital/dp-cli/config"
+	"github.com/ONSdigital/dp-cli/ssh/sshtest"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -55,6 +62,26 @@ func TestGetPortArguments(t *testing.T) {
 			})
 		})
 
+		Convey("When other valid forms are provided", func() {
+			validCases := map[string]string{
+				"11500:Hosty.Example.COM:11400":         "11500:Hosty.Example.COM:11400",
+				"11500:10.0.0.1:11400":                  "11500:10.0.0.1:11400",
+				"11500:[::1]:11400":                     "11500:[::1]:11400",
+				"11500:[fe80::1%eth0]:11400":            "11500:[fe80::1%eth0]:11400",
+				"2375:/var/run/docker.sock":             "2375:/var/run/docker.sock",
+				"/tmp/docker.sock:/var/run/docker.sock": "/tmp/docker.sock:/var/run/docker.sock",
+				"/tmp/mongo.sock:mongo:27017":           "/tmp/mongo.sock:mongo:27017",
+			}
+
+			for valid, expected := range validCases {
+				sshArgs, err := getSSHPortArguments(valid)
+				Convey(fmt.Sprintf("Then '%s' should be forwarded as '%s'", valid, expected), func() {
+					So(err, ShouldBeNil)
+					So(sshArgs, ShouldResemble, []string{"-L", expected})
+				})
+			}
+		})
+
 		Convey("When invalid arguments are supplied", func() {
 			invalidCases := []string{
 				"moo",
@@ -65,6 +92,13 @@ func TestGetPortArguments(t *testing.T) {
 				"123:hosty:",
 				"123:hosty:3:4",
 				"",
+				"0",
+				"65536",
+				"123:[::1:80",
+				"123:[not:ipv6]:80",
+				"123:bad host:80",
+				"/tmp/only.sock",
+				"123:relative.sock",
 			}
 
 			for _, invalid := range invalidCases {
@@ -81,3 +115,222 @@ func TestGetPortArguments(t *testing.T) {
 		})
 	})
 }
+
+func TestExpandServicePortArg(t *testing.T) {
+	Convey("Given services are configured for port forwarding", t, func() {
+		services := map[string]config.Service{
+			"dataset-api": {Port: 22000},
+			"zebedee":     {Port: 8082, LocalPort: 18082},
+			"mongo":       {Host: "mongo.internal", Port: 27017},
+			"broken":      {},
+		}
+		busyPorts := map[int]bool{}
+		isPortFree := func(port int) bool { return !busyPorts[port] }
+		freePort := func() (int, error) { return 40000, nil }
+
+		cases := []struct{ portArg, expected string }{
+			{"dataset-api", "22000:localhost:22000"},
+			{"zebedee", "18082:localhost:8082"},
+			{"mongo", "27017:mongo.internal:27017"},
+			{"9999:mongo", "9999:mongo.internal:27017"},
+			{"11400", "11400"},
+			{"11500:11400", "11500:11400"},
+			{"11500:hosty:11400", "11500:hosty:11400"},
+			{"unknown", "unknown"},
+		}
+		for _, tc := range cases {
+			Convey(fmt.Sprintf("Then '%s' should expand to '%s'", tc.portArg, tc.expected), func() {
+				expanded, err := expandServicePortArg(tc.portArg, services, isPortFree, freePort)
+				So(err, ShouldBeNil)
+				So(expanded, ShouldEqual, tc.expected)
+			})
+		}
+
+		Convey("When the local port for a service is busy", func() {
+			busyPorts[22000] = true
+			expanded, err := expandServicePortArg("dataset-api", services, isPortFree, freePort)
+
+			Convey("Then a free local port should be used", func() {
+				So(err, ShouldBeNil)
+				So(expanded, ShouldEqual, "40000:localhost:22000")
+			})
+
+			Convey("Then an explicit local port should be kept", func() {
+				expanded, err := expandServicePortArg("22000:dataset-api", services, isPortFree, freePort)
+				So(err, ShouldBeNil)
+				So(expanded, ShouldEqual, "22000:localhost:22000")
+			})
+		})
+
+		Convey("When a service has no port", func() {
+			_, err := expandServicePortArg("broken", services, isPortFree, freePort)
+
+			Convey("Then there should be an error returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestGetRemoteForwardArguments(t *testing.T) {
+	Convey("Given remote port forwarding arguments need to be translated", t, func() {
+
+		Convey("When a remote and local port are provided", func() {
+			sshArgs, err := getSSHRemoteForwardArguments("9000:3000")
+
+			Convey("Then the ssh remote forwarding should match", func() {
+				So(err, ShouldBeNil)
+				So(sshArgs, ShouldResemble, []string{"-R", "9000:localhost:3000"})
+			})
+		})
+
+		Convey("When a remote port, local host and port are provided", func() {
+			sshArgs, err := getSSHRemoteForwardArguments("9000:[::1]:3000")
+
+			Convey("Then the ssh remote forwarding should match", func() {
+				So(err, ShouldBeNil)
+				So(sshArgs, ShouldResemble, []string{"-R", "9000:[::1]:3000"})
+			})
+		})
+
+		Convey("When an invalid argument is supplied", func() {
+			sshArgs, err := getSSHRemoteForwardArguments("9000:")
+
+			Convey("Then there should be an error returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "is not a valid port forwarding argument")
+				So(sshArgs, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestGetSocksArguments(t *testing.T) {
+	Convey("Given SOCKS arguments need to be translated", t, func() {
+		validCases := []string{"1080", "localhost:1080", "127.0.0.1:1080", "[::1]:1080"}
+		for _, valid := range validCases {
+			sshArgs, err := getSSHSocksArguments(valid)
+			Convey(fmt.Sprintf("Then '%s' should be a dynamic forward", valid), func() {
+				So(err, ShouldBeNil)
+				So(sshArgs, ShouldResemble, []string{"-D", valid})
+			})
+		}
+
+		invalidCases := []string{"", "socks", "host:", "a:b:1080", "99999", "bad host:1080"}
+		for _, invalid := range invalidCases {
+			sshArgs, err := getSSHSocksArguments(invalid)
+			Convey(fmt.Sprintf("Then there should be an error returned for '%s'", invalid), func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "is not a valid SOCKS argument")
+				So(sshArgs, ShouldBeNil)
+			})
+		}
+	})
+}
+
+func TestGetJumpHostArguments(t *testing.T) {
+	Convey("Given jump host arguments need to be translated", t, func() {
+		validCases := []string{"bastion", "ubuntu@Bastion.Example.com", "bastion:2222", "a@[::1]:22,b@10.0.0.1"}
+		for _, valid := range validCases {
+			sshArgs, err := getSSHJumpHostArguments(valid)
+			Convey(fmt.Sprintf("Then '%s' should be a jump host", valid), func() {
+				So(err, ShouldBeNil)
+				So(sshArgs, ShouldResemble, []string{"-J", valid})
+			})
+		}
+
+		invalidCases := []string{"", "bad host", "@bastion", "bastion:", "bastion:port", "a,,b"}
+		for _, invalid := range invalidCases {
+			sshArgs, err := getSSHJumpHostArguments(invalid)
+			Convey(fmt.Sprintf("Then there should be an error returned for '%s'", invalid), func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "is not a valid jump host argument")
+				So(sshArgs, ShouldBeNil)
+			})
+		}
+	})
+}
+
+func TestGetScriptCommand(t *testing.T) {
+	Convey("Given a local script is to be run remotely", t, func() {
+
+		Convey("When the script has no #! line", func() {
+			cmd := getScriptCommand([]byte("echo hello\n"), nil, false)
+
+			Convey("Then it should be run by sh from stdin", func() {
+				So(cmd, ShouldEqual, "sh /dev/stdin")
+			})
+		})
+
+		Convey("When the script has a #! line, args and sudo", func() {
+			cmd := getScriptCommand([]byte("#!/usr/bin/env bash\nset -e\n"), []string{"-v", "two words", "it's", ""}, true)
+
+			Convey("Then it should be run by the interpreter with sudo, and the args quoted", func() {
+				So(cmd, ShouldEqual, `sudo /usr/bin/env bash /dev/stdin -v 'two words' 'it'\''s' ''`)
+			})
+		})
+
+		Convey("When an arg has shell metacharacters", func() {
+			cmd := getScriptCommand([]byte("#!/bin/sh\n"), []string{"$(rm -rf /); `x` > y"}, false)
+
+			Convey("Then they should be quoted", func() {
+				So(cmd, ShouldEqual, `/bin/sh /dev/stdin '$(rm -rf /); `+"`x`"+` > y'`)
+			})
+		})
+	})
+}
+
+func TestLaunchExitCodes(t *testing.T) {
+	Convey("Given ssh to three instances, two of which fail", t, func() {
+		runs := filepath.Join(t.TempDir(), "runs")
+		// a fake ssh which fails on i-2 (code 3) and i-3 (code 5), and logs its runs
+		cfg := sshtest.UseSSHScript(t, "#!/bin/sh\necho \"$*\" >> "+runs+"\ncase \"$*\" in *i-2*) exit 3;; *i-3*) exit 5;; esac\n")
+		env := config.Environment{Name: "sandbox"}
+		instances := []aws.EC2Result{{InstanceId: "i-1"}, {InstanceId: "i-2"}, {InstanceId: "i-3"}}
+
+		launch := func(policy string) (error, int) {
+			quiet, to, verbose := true, 0, 0
+			opts := SSHOpts{QuietFlag: &quiet, InstanceNumMax: &to, VerboseCount: &verbose, ExitPolicy: &policy}
+			err := Launch(cfg, env, 0, opts, []string{"true"}, instances)
+			b, _ := os.ReadFile(runs)
+			os.Remove(runs)
+			return err, strings.Count(string(b), "\n")
+		}
+
+		Convey("When the exit policy is first", func() {
+			err, runs := launch(EXIT_FIRST)
+
+			Convey("Then it should stop at the first failure, with its exit code", func() {
+				So(cli.ExitCode(err), ShouldEqual, 3)
+				So(runs, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the exit policy is max", func() {
+			err, runs := launch(EXIT_MAX)
+
+			Convey("Then it should run on all instances, exiting with the highest code", func() {
+				So(cli.ExitCode(err), ShouldEqual, 5)
+				So(runs, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When the exit policy is count", func() {
+			err, runs := launch(EXIT_COUNT)
+
+			Convey("Then it should run on all instances, exiting with the number of failures", func() {
+				So(cli.ExitCode(err), ShouldEqual, 2)
+				So(runs, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When the exit policy is unknown", func() {
+			err, runs := launch("last")
+
+			Convey("Then nothing should be run", func() {
+				So(err, ShouldNotBeNil)
+				So(runs, ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,42 @@
+// Package sshtest provides a fake ssh for tests of the commands run on instances
+package sshtest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ONSdigital/dp-cli/config"
+)
+
+// RunLocally is the script of a fake ssh which runs the remote command (its last arg) locally
+const RunLocally = "#!/bin/sh\nfor last; do :; done\nexec sh -c \"$last\"\n"
+
+// UseFakeSSH puts a fake ssh (which runs remote commands locally) first on the PATH for the test,
+// and returns a config for it (with an ansible dir for ssh to run in)
+func UseFakeSSH(t testing.TB) *config.Config {
+	return UseSSHScript(t, RunLocally)
+}
+
+// UseSSHScript is UseFakeSSH with the ssh `script`
+func UseSSHScript(t testing.TB, script string) *config.Config {
+	t.Helper()
+	setup := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(setup, "ansible"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	AddCommand(t, "ssh", script)
+
+	sshUser := "ubuntu"
+	return &config.Config{SSHUser: &sshUser, DPSetupPath: setup}
+}
+
+// AddCommand puts the `script` first on the PATH for the test, as the command `name`
+func AddCommand(t testing.TB, name, script string) {
+	t.Helper()
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package tunnel
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startDetached starts the command in its own session, so it outlives this process
+func startDetached(path string, args []string, logFile *os.File) (int, error) {
+	c := exec.Command(path, args...)
+	c.Stdout = logFile
+	c.Stderr = logFile
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := c.Start(); err != nil {
+		return 0, err
+	}
+	pid := c.Process.Pid
+	return pid, c.Process.Release()
+}
+
+func isProcessRunning(pid int) bool {
+	return syscall.Kill(pid, syscall.Signal(0)) == nil
+}
+
+func stopProcess(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package tunnel
+
+import (
+	"errors"
+	"os"
+)
+
+var errUnsupported = errors.New("background tunnels are not supported on windows")
+
+func startDetached(path string, args []string, logFile *os.File) (int, error) {
+	return 0, errUnsupported
+}
+
+func isProcessRunning(pid int) bool {
+	return false
+}
+
+func stopProcess(pid int) error {
+	return errUnsupported
+}
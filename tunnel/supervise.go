@@ -0,0 +1,97 @@
+package tunnel
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ONSdigital/dp-cli/config"
+)
+
+const (
+	minBackoff   = time.Second
+	maxBackoff   = 30 * time.Second
+	stableUptime = time.Minute // a connection up this long resets the backoff
+)
+
+// Supervise runs (in the background) the ssh connection for the named tunnel,
+// reconnecting whenever it drops, until signalled to stop
+func Supervise(cfg *config.Config, name string) error {
+	dir, err := getDir(cfg)
+	if err != nil {
+		return err
+	}
+	t, err := load(dir, name)
+	if err != nil {
+		return err
+	}
+	defer remove(dir, name)
+
+	// `tunnel open` waits for this, so save the pid before connecting
+	t.PID = os.Getpid()
+	if err = t.save(dir); err != nil {
+		return err
+	}
+
+	stopC := make(chan os.Signal, 1)
+	signal.Notify(stopC, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+	logger := log.New(os.Stderr, "[dp tunnel "+name+"] ", log.LstdFlags)
+	backoff := minBackoff
+	for {
+		c := exec.Command("ssh", t.Args...)
+		c.Dir = t.Dir
+		c.Stdout = os.Stderr
+		c.Stderr = os.Stderr
+		c.Env = os.Environ()
+		if t.Profile != "" {
+			c.Env = append(c.Env, "AWS_PROFILE="+t.Profile)
+		}
+
+		logger.Printf("connecting: ssh %v", t.Args)
+		connected := time.Now()
+		if err = c.Start(); err != nil {
+			return fmt.Errorf("cannot start ssh: %w", err)
+		}
+		t.SSHPID = c.Process.Pid
+		if err = t.save(dir); err != nil {
+			logger.Printf("cannot save state: %s", err)
+		}
+
+		doneC := make(chan error, 1)
+		go func() { doneC <- c.Wait() }()
+
+		select {
+		case sig := <-stopC:
+			logger.Printf("%s: closing", sig)
+			c.Process.Signal(syscall.SIGTERM)
+			<-doneC
+			return nil
+		case err = <-doneC:
+		}
+
+		if time.Since(connected) > stableUptime {
+			backoff = minBackoff
+		}
+		t.Restarts++
+		t.LastError = fmt.Sprintf("ssh exited: %v", err)
+		logger.Printf("%s - reconnecting in %s", t.LastError, backoff)
+		if err = t.save(dir); err != nil {
+			logger.Printf("cannot save state: %s", err)
+		}
+
+		select {
+		case sig := <-stopC:
+			logger.Printf("%s: closing", sig)
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
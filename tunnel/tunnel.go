@@ -0,0 +1,185 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/dp-cli/config"
+)
+
+const runtimeSubDir = "tunnels"
+
+var validName = regexp.MustCompile(`^[-a-zA-Z0-9_.]+$`)
+
+// startTimeout is how long a new supervisor has to record its pid in the tunnel's state
+const startTimeout = 10 * time.Second
+
+// Tunnel is the state of a background port-forward, saved as JSON in the runtime dir
+type Tunnel struct {
+	Name        string    `json:"name"`
+	PID         int       `json:"pid"`     // the supervisor (`dp tunnel supervise`)
+	SSHPID      int       `json:"ssh_pid"` // the current ssh connection
+	Environment string    `json:"environment"`
+	Target      string    `json:"target"` // e.g. "publishing 1 (i-0123...)"
+	Ports       []string  `json:"ports"`
+	Dir         string    `json:"dir"`
+	Args        []string  `json:"args"`
+	Profile     string    `json:"profile,omitempty"`
+	Started     time.Time `json:"started"`
+	Restarts    int       `json:"restarts"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// Uptime is how long the tunnel has been open
+func (t Tunnel) Uptime() time.Duration {
+	return time.Since(t.Started).Round(time.Second)
+}
+
+// IsRunning is true when the tunnel's supervisor is still running
+func (t Tunnel) IsRunning() bool {
+	return t.PID > 0 && isProcessRunning(t.PID)
+}
+
+func getDir(cfg *config.Config) (string, error) {
+	return cfg.GetRuntimeDir(runtimeSubDir)
+}
+
+func statePath(dir, name string) string {
+	return filepath.Join(dir, name+".json")
+}
+
+// LogPath is where the tunnel's supervisor and ssh output is written
+func LogPath(dir, name string) string {
+	return filepath.Join(dir, name+".log")
+}
+
+func (t Tunnel) save(dir string) error {
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := statePath(dir, t.Name) + ".tmp"
+	if err = os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, statePath(dir, t.Name))
+}
+
+func load(dir, name string) (t Tunnel, err error) {
+	b, err := os.ReadFile(statePath(dir, name))
+	if err != nil {
+		return t, err
+	}
+	err = json.Unmarshal(b, &t)
+	return t, err
+}
+
+func remove(dir, name string) {
+	os.Remove(statePath(dir, name))
+	os.Remove(LogPath(dir, name))
+}
+
+// List returns the running tunnels, removing the state of any that have stopped
+func List(cfg *config.Config) ([]Tunnel, error) {
+	dir, err := getDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var tunnels []Tunnel
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		t, err := load(dir, name)
+		if err != nil {
+			continue
+		}
+		if t.PID == 0 && time.Since(t.Started) < startTimeout {
+			continue // its supervisor is starting
+		}
+		if !t.IsRunning() {
+			remove(dir, name)
+			continue
+		}
+		tunnels = append(tunnels, t)
+	}
+	sort.Slice(tunnels, func(i, j int) bool { return tunnels[i].Name < tunnels[j].Name })
+	return tunnels, nil
+}
+
+// Open starts a supervisor process (the `dp` binary with `superviseArgs`) in the background
+// that keeps the tunnel `t` connected
+func Open(cfg *config.Config, t Tunnel, superviseArgs []string) error {
+	if !validName.MatchString(t.Name) {
+		return fmt.Errorf("%q is not a valid tunnel name (use letters, digits, '-', '_', '.')", t.Name)
+	}
+	dir, err := getDir(cfg)
+	if err != nil {
+		return err
+	}
+	if existing, err := load(dir, t.Name); err == nil && existing.IsRunning() {
+		return fmt.Errorf("tunnel %q is already open (pid %d) - close it or use `--name`", t.Name, existing.PID)
+	}
+
+	t.Started = time.Now()
+	if err = t.save(dir); err != nil {
+		return err
+	}
+
+	logFile, err := os.OpenFile(LogPath(dir, t.Name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	pid, err := startDetached(self, append(superviseArgs, t.Name), logFile)
+	if err != nil {
+		remove(dir, t.Name)
+		return err
+	}
+	// only the supervisor writes its (and ssh's) pids to the state, so wait for it to record them
+	for deadline := time.Now().Add(startTimeout); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		started, err := load(dir, t.Name)
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("tunnel %q (pid %d) stopped on start", t.Name, pid)
+		} else if err == nil && started.PID != 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("tunnel %q (pid %d) has not started after %s - see %s", t.Name, pid, startTimeout, LogPath(dir, t.Name))
+}
+
+// Close stops the named tunnel
+func Close(cfg *config.Config, name string) error {
+	dir, err := getDir(cfg)
+	if err != nil {
+		return err
+	}
+	t, err := load(dir, name)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no tunnel named %q", name)
+	} else if err != nil {
+		return err
+	}
+	if t.IsRunning() {
+		if err = stopProcess(t.PID); err != nil {
+			return fmt.Errorf("cannot stop tunnel %q (pid %d): %w", name, t.PID, err)
+		}
+	}
+	remove(dir, name)
+	return nil
+}